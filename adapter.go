@@ -19,6 +19,7 @@ package hugot
 
 import (
 	"context"
+	"fmt"
 )
 
 const adapterKey key = 0
@@ -35,6 +36,16 @@ func AdapterFromContext(ctx context.Context) (Adapter, bool) {
 	return a, ok
 }
 
+// AdapterName returns a name for the adapter stored in ctx, suitable for
+// use in logs and metrics, or for telling adapters apart.
+func AdapterName(ctx context.Context) string {
+	a, ok := AdapterFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%T", a)
+}
+
 // SenderFromContext can be used to retrieve a valid sender from
 // a context. This is mostly useful in WebHook handlers for sneding
 // messages back to the inbound Adapter.
@@ -67,6 +78,13 @@ func IsTextOnly(s Sender) bool {
 	return ok
 }
 
+// PageLimiter is implemented by adapters that cannot usefully send
+// arbitrarily long messages. Long output written to a ResponseWriter by
+// a handler is split into pages that fit within the limits.
+type PageLimiter interface {
+	PageLimit() (chars, lines int) // Maximum characters, and lines, of a message, 0 for no limit
+}
+
 // User represents a user within the chat sytems. The adapter is responsible
 // for translating the string User to and from it's external representation
 type User string
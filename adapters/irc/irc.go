@@ -21,7 +21,6 @@ package irc
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -30,6 +29,7 @@ import (
 
 	"github.com/fluffle/goirc/client"
 	iglog "github.com/fluffle/goirc/logging/glog"
+	"github.com/fluffle/goirc/state"
 	"github.com/golang/glog"
 	"github.com/tcolgate/hugot"
 )
@@ -38,6 +38,9 @@ type irc struct {
 	cfg      *client.Config
 	defChans []string
 
+	triggerLock sync.Mutex
+	trigger     hugot.Trigger
+
 	c chan *hugot.Message
 
 	start sync.Once
@@ -50,6 +53,8 @@ func New(c *client.Config, chans ...string) hugot.Adapter {
 	a := &irc{
 		c,
 		chans,
+		sync.Mutex{},
+		DefaultTrigger,
 		make(chan *hugot.Message),
 		sync.Once{},
 		nil,
@@ -58,6 +63,66 @@ func New(c *client.Config, chans ...string) hugot.Adapter {
 	return a
 }
 
+// DefaultTrigger addresses the bot with a leading mention of its nick
+var DefaultTrigger = hugot.Trigger{Mentions: true}
+
+// SetTrigger sets how the adapter decides if a message was sent to the bot.
+func (i *irc) SetTrigger(t hugot.Trigger) {
+	i.triggerLock.Lock()
+	defer i.triggerLock.Unlock()
+
+	i.trigger = t
+}
+
+func (i *irc) getTrigger() hugot.Trigger {
+	i.triggerLock.Lock()
+	defer i.triggerLock.Unlock()
+
+	return i.trigger
+}
+
+// BotNames implements hugot.BotNamer
+func (i *irc) BotNames() []string {
+	return []string{i.Me().Nick}
+}
+
+// PageLimit implements hugot.PageLimiter. Each line is sent as a separate
+// IRC message, so long output is limited to a few lines at a time.
+func (i *irc) PageLimit() (int, int) {
+	return 0, 10
+}
+
+// Dialect converts hugot markup to IRC formatting control codes. Each line
+// is sent as a separate message, so formatting is applied line by line.
+var Dialect = hugot.Dialect{
+	Bold:   ircCode("\x02"),
+	Italic: ircCode("\x1d"),
+	Code:   ircCode("\x11"),
+	Pre:    ircCode("\x11"),
+	User:   func(u string) string { return u },
+}
+
+func ircCode(c string) func(string) string {
+	return func(s string) string {
+		ls := strings.Split(s, "\n")
+		for i := range ls {
+			if ls[i] != "" {
+				ls[i] = c + ls[i] + c
+			}
+		}
+		return strings.Join(ls, "\n")
+	}
+}
+
+// Format implements hugot.Formatter
+func (i *irc) Format(markup string) string {
+	return Dialect.Render(markup)
+}
+
+// IsTextOnly implements hugot.TextOnly
+func (i *irc) IsTextOnly() {
+}
+
 func (i *irc) Send(ctx context.Context, m *hugot.Message) {
 	i.Start()
 	if m.Private {
@@ -113,6 +178,15 @@ func (i *irc) run() {
 			i.c <- i.eventToHugot(l)
 		})
 
+		for cmd, typ := range ircEvents {
+			typ := typ
+			i.HandleFunc(cmd, func(conn *client.Conn, l *client.Line) {
+				if m := i.chatEventToHugot(l, typ); m != nil {
+					i.c <- m
+				}
+			})
+		}
+
 		i.HandleFunc(client.CONNECTED, func(conn *client.Conn, l *client.Line) {
 			if glog.V(1) {
 				glog.Info("IRC Connected")
@@ -128,6 +202,39 @@ func (i *irc) run() {
 
 }
 
+// ircEvents maps IRC commands to the hugot events they report
+var ircEvents = map[string]hugot.EventType{
+	client.JOIN:  hugot.EventJoin,
+	client.PART:  hugot.EventLeave,
+	client.QUIT:  hugot.EventLeave,
+	client.TOPIC: hugot.EventTopic,
+}
+
+// chatEventToHugot converts a JOIN, PART, QUIT or TOPIC line to a hugot
+// event. Users quitting are reported as leaving, with no channel.
+func (i *irc) chatEventToHugot(l *client.Line, typ hugot.EventType) *hugot.Message {
+	if l.Nick == i.Me().Nick {
+		return nil
+	}
+
+	e := &hugot.Event{Type: typ}
+	if typ == hugot.EventTopic {
+		e.Topic = l.Text()
+	}
+
+	channel := ""
+	if l.Cmd != client.QUIT {
+		channel = l.Target()
+	}
+
+	return &hugot.Message{
+		Channel: channel,
+		From:    l.Nick,
+		UserID:  fmt.Sprintf("%s@%s", l.Ident, l.Host),
+		Event:   e,
+	}
+}
+
 func (i *irc) eventToHugot(l *client.Line) *hugot.Message {
 	txt := l.Text()
 	nick := i.Me().Nick
@@ -138,15 +245,9 @@ func (i *irc) eventToHugot(l *client.Line) *hugot.Message {
 	if l.Public() {
 		// Check if the message was sent @bot, if so, set it as to us
 		// and strip the leading politeness
-		dir := regexp.MustCompile(fmt.Sprintf("^%s[:, ]+(.*)", nick))
-		dirMatch := dir.FindStringSubmatch(txt)
-		if glog.V(3) {
-			glog.Infof("Match %#v", dirMatch)
-		}
-
-		if len(dirMatch) > 1 {
+		if t, ok := i.getTrigger().Match([]string{nick}, txt); ok {
 			tobot = true
-			txt = strings.Trim(dirMatch[1], " ")
+			txt = t
 		}
 	} else {
 		tobot = true
@@ -154,12 +255,163 @@ func (i *irc) eventToHugot(l *client.Line) *hugot.Message {
 	}
 
 	return &hugot.Message{
-		Channel: channel,
-		From:    l.Nick,
-		To:      nick,
-		Text:    txt,
-		ToBot:   tobot,
-		UserID:  fmt.Sprintf("%s@%s", l.Ident, l.Host),
-		Private: priv,
+		Channel:  channel,
+		From:     l.Nick,
+		To:       nick,
+		Text:     txt,
+		RawText:  l.Text(),
+		ToBot:    tobot,
+		UserID:   fmt.Sprintf("%s@%s", l.Ident, l.Host),
+		Private:  priv,
+		Mentions: i.mentions(txt),
+	}
+}
+
+// UserByID implements hugot.UserDirectory. Users are identified by
+// ident@host, and can only be found if they share a channel with the bot.
+func (i *irc) UserByID(ctx context.Context, id string) (*hugot.UserInfo, error) {
+	st := i.StateTracker()
+	if st == nil {
+		return nil, hugot.ErrNoUserDirectory
+	}
+	for c := range i.Me().Channels {
+		ch := st.GetChannel(c)
+		if ch == nil {
+			continue
+		}
+		for n := range ch.Nicks {
+			if nk := st.GetNick(n); nk != nil && nk.Ident+"@"+nk.Host == id {
+				return ircUserInfo(nk), nil
+			}
+		}
+	}
+	return nil, hugot.ErrUnknownUser
+}
+
+// UserByName implements hugot.UserDirectory, for nicks known to the state
+// tracker.
+func (i *irc) UserByName(ctx context.Context, name string) (*hugot.UserInfo, error) {
+	st := i.StateTracker()
+	if st == nil {
+		return nil, hugot.ErrNoUserDirectory
+	}
+	nk := st.GetNick(name)
+	if nk == nil {
+		return nil, hugot.ErrUnknownUser
+	}
+	return ircUserInfo(nk), nil
+}
+
+func ircUserInfo(nk *state.Nick) *hugot.UserInfo {
+	return &hugot.UserInfo{
+		ID:          nk.Ident + "@" + nk.Host,
+		Name:        nk.Nick,
+		DisplayName: nk.Name,
+	}
+}
+
+// ircChannelInfo returns details of the channel from the state tracker
+func (i *irc) ircChannelInfo(st state.Tracker, name string) *hugot.ChannelInfo {
+	ch := st.GetChannel(name)
+	if ch == nil {
+		return nil
+	}
+	_, member := i.Me().Channels[ch.Name]
+	return &hugot.ChannelInfo{
+		ID:      ch.Name,
+		Name:    strings.TrimPrefix(ch.Name, "#"),
+		Topic:   ch.Topic,
+		Private: ch.Modes.Private || ch.Modes.Secret,
+		Member:  member,
+	}
+}
+
+// Channels implements hugot.ChannelDirectory, listing the channels the bot
+// has joined.
+func (i *irc) Channels(ctx context.Context) ([]hugot.ChannelInfo, error) {
+	st := i.StateTracker()
+	if st == nil {
+		return nil, hugot.ErrNoChannelDirectory
+	}
+	cis := []hugot.ChannelInfo{}
+	for c := range i.Me().Channels {
+		if ci := i.ircChannelInfo(st, c); ci != nil {
+			cis = append(cis, *ci)
+		}
+	}
+	return cis, nil
+}
+
+// ChannelByID implements hugot.ChannelDirectory. Channels are identified by
+// their full name, e.g. "#hugot", and can only be found once joined.
+func (i *irc) ChannelByID(ctx context.Context, id string) (*hugot.ChannelInfo, error) {
+	st := i.StateTracker()
+	if st == nil {
+		return nil, hugot.ErrNoChannelDirectory
+	}
+	ci := i.ircChannelInfo(st, id)
+	if ci == nil {
+		return nil, hugot.ErrUnknownChannel
+	}
+	return ci, nil
+}
+
+// ChannelByName implements hugot.ChannelDirectory
+func (i *irc) ChannelByName(ctx context.Context, name string) (*hugot.ChannelInfo, error) {
+	return i.ChannelByID(ctx, "#"+strings.TrimPrefix(name, "#"))
+}
+
+// JoinChannel implements hugot.ChannelDirectory. As channels are
+// identified by name, the channel need not be known to the state tracker.
+func (i *irc) JoinChannel(ctx context.Context, id string) error {
+	i.Join(id)
+	return nil
+}
+
+// LeaveChannel implements hugot.ChannelDirectory
+func (i *irc) LeaveChannel(ctx context.Context, id string) error {
+	i.Part(id)
+	return nil
+}
+
+// ChannelMembers implements hugot.ChannelDirectory
+func (i *irc) ChannelMembers(ctx context.Context, id string) ([]hugot.UserInfo, error) {
+	st := i.StateTracker()
+	if st == nil {
+		return nil, hugot.ErrNoChannelDirectory
+	}
+	ch := st.GetChannel(id)
+	if ch == nil {
+		return nil, hugot.ErrUnknownChannel
+	}
+	us := []hugot.UserInfo{}
+	for n := range ch.Nicks {
+		if nk := st.GetNick(n); nk != nil {
+			us = append(us, *ircUserInfo(nk))
+		}
+	}
+	return us, nil
+}
+
+// SetChannelTopic implements hugot.ChannelDirectory
+func (i *irc) SetChannelTopic(ctx context.Context, id, topic string) error {
+	i.Topic(id, topic)
+	return nil
+}
+
+// mentions finds channels, and nicks known to the state tracker, mentioned
+// in txt.
+func (i *irc) mentions(txt string) []hugot.Mention {
+	st := i.StateTracker()
+	var mns []hugot.Mention
+	for _, w := range strings.Fields(txt) {
+		w = strings.TrimRight(strings.TrimLeft(w, "@"), ":,.!?")
+		switch {
+		case strings.HasPrefix(w, "#") && len(w) > 1:
+			mns = append(mns, hugot.Mention{Type: hugot.ChannelMention, ID: w, Name: w[1:]})
+		case st != nil && w != "" && st.GetNick(w) != nil:
+			mns = append(mns, hugot.Mention{Type: hugot.UserMention, ID: w, Name: w})
+		}
 	}
+	return mns
 }
@@ -21,9 +21,12 @@ package mm
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
 
 	"context"
 
@@ -59,18 +62,27 @@ type mma struct {
 	id   string
 	icon string
 
-	dirPat      *regexp.Regexp
+	triggerLock sync.Mutex
+	trigger     hugot.Trigger
+
 	api         *mm.Client
 	initialLoad *mm.InitialLoad
 
 	ws *mm.WebSocketClient
 
 	sender chan *hugot.Message
+
+	usersLock sync.Mutex
+	users     map[string]*mm.User // by ID
+	userIDs   map[string]string   // by user name
+
+	channelsLock sync.Mutex
+	channelIDs   map[string]string // by channel name
 }
 
 // New creates a new adapter that communicates with Mattermost
 func New(apiurl, team, email, password string) (hugot.Adapter, error) {
-	c := mma{client: mm.NewClient(apiurl)}
+	c := mma{client: mm.NewClient(apiurl), trigger: DefaultTrigger}
 
 	lr, err := c.client.Login(email, password)
 	if err != nil {
@@ -98,9 +110,6 @@ func New(apiurl, team, email, password string) (hugot.Adapter, error) {
 
 	c.client.SetTeamId(c.team.Id)
 
-	pat := fmt.Sprintf("^@%s[:,]? (.*)", c.user.Username)
-	c.dirPat = regexp.MustCompile(pat)
-
 	wsurl, _ := url.Parse(apiurl)
 	wsurl.Scheme = "ws"
 	c.ws, err = mm.NewWebSocketClient(wsurl.String(), c.client.AuthToken)
@@ -113,10 +122,390 @@ func New(apiurl, team, email, password string) (hugot.Adapter, error) {
 	return &c, nil
 }
 
+// DefaultTrigger addresses the bot with a leading @mention
+var DefaultTrigger = hugot.Trigger{Mentions: true}
+
+// SetTrigger sets how the adapter decides if a message was sent to the bot.
+func (s *mma) SetTrigger(t hugot.Trigger) {
+	s.triggerLock.Lock()
+	defer s.triggerLock.Unlock()
+
+	s.trigger = t
+}
+
+func (s *mma) getTrigger() hugot.Trigger {
+	s.triggerLock.Lock()
+	defer s.triggerLock.Unlock()
+
+	return s.trigger
+}
+
+// BotNames implements hugot.BotNamer
+func (s *mma) BotNames() []string {
+	return []string{"@" + s.user.Username}
+}
+
+// getUser returns the user with the given ID, caching the result. The
+// lock is not held while the user is fetched.
+func (s *mma) getUser(id string) (*mm.User, error) {
+	s.usersLock.Lock()
+	u, ok := s.users[id]
+	s.usersLock.Unlock()
+	if ok {
+		return u, nil
+	}
+
+	r, err := s.client.GetUser(id, "")
+	if err != nil {
+		return nil, err
+	}
+	u = r.Data.(*mm.User)
+	s.cacheUser(u)
+	return u, nil
+}
+
+func (s *mma) cacheUser(u *mm.User) {
+	s.usersLock.Lock()
+	defer s.usersLock.Unlock()
+
+	if s.users == nil {
+		s.users = make(map[string]*mm.User)
+		s.userIDs = make(map[string]string)
+	}
+	s.users[u.Id] = u
+	s.userIDs[u.Username] = u.Id
+}
+
+// cachedUserByName returns the named user, if it has been seen before
+func (s *mma) cachedUserByName(name string) (*mm.User, bool) {
+	s.usersLock.Lock()
+	defer s.usersLock.Unlock()
+
+	u, ok := s.users[s.userIDs[name]]
+	return u, ok
+}
+
+// getUserByName returns the named user, caching the result
+func (s *mma) getUserByName(name string) (*mm.User, error) {
+	if u, ok := s.cachedUserByName(name); ok {
+		return u, nil
+	}
+
+	r, err := s.client.GetByUsername(name, "")
+	if err != nil {
+		return nil, err
+	}
+	u := r.Data.(*mm.User)
+	s.cacheUser(u)
+	return u, nil
+}
+
+// cachedChannelID returns the ID of the named channel, if it has been
+// seen before
+func (s *mma) cachedChannelID(name string) (string, bool) {
+	s.channelsLock.Lock()
+	defer s.channelsLock.Unlock()
+
+	id, ok := s.channelIDs[name]
+	return id, ok
+}
+
+// getChannelID returns the ID of the named channel, caching the result
+func (s *mma) getChannelID(name string) (string, error) {
+	if id, ok := s.cachedChannelID(name); ok {
+		return id, nil
+	}
+
+	r, err := s.client.GetChannelByName(name)
+	if err != nil {
+		return "", err
+	}
+	id := r.Data.(*mm.Channel).Id
+
+	s.channelsLock.Lock()
+	defer s.channelsLock.Unlock()
+	if s.channelIDs == nil {
+		s.channelIDs = make(map[string]string)
+	}
+	s.channelIDs[name] = id
+	return id, nil
+}
+
+// userName returns the name of the user with the given ID, or the ID
+// itself if the user cannot be found.
+func (s *mma) userName(id string) string {
+	if id == "" {
+		return ""
+	}
+	u, err := s.getUser(id)
+	if err != nil {
+		glog.Infof("could not resolve user %s, %v", id, err)
+		return id
+	}
+	return u.Username
+}
+
+// UserByID implements hugot.UserDirectory. Mattermost does not report the
+// time zone of users, so TimeZone is left empty.
+func (s *mma) UserByID(ctx context.Context, id string) (*hugot.UserInfo, error) {
+	u, err := s.getUser(id)
+	if err != nil {
+		return nil, err
+	}
+	return mmUserInfo(u), nil
+}
+
+// UserByName implements hugot.UserDirectory
+func (s *mma) UserByName(ctx context.Context, name string) (*hugot.UserInfo, error) {
+	u, err := s.getUserByName(strings.TrimPrefix(name, "@"))
+	if err != nil {
+		return nil, err
+	}
+	return mmUserInfo(u), nil
+}
+
+func mmUserInfo(u *mm.User) *hugot.UserInfo {
+	dn := u.Nickname
+	if dn == "" {
+		dn = u.GetFullName()
+	}
+	return &hugot.UserInfo{
+		ID:          u.Id,
+		Name:        u.Username,
+		DisplayName: dn,
+		Email:       u.Email,
+	}
+}
+
+func mmChannelInfo(c *mm.Channel, member bool) hugot.ChannelInfo {
+	return hugot.ChannelInfo{
+		ID:      c.Id,
+		Name:    c.Name,
+		Topic:   c.Header,
+		Private: c.Type == mm.CHANNEL_PRIVATE,
+		Member:  member,
+	}
+}
+
+// Channels implements hugot.ChannelDirectory, listing the channels the
+// bot is a member of, and the public channels it could join.
+func (s *mma) Channels(ctx context.Context) ([]hugot.ChannelInfo, error) {
+	cis := []hugot.ChannelInfo{}
+
+	r, err := s.client.GetChannels("")
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range *r.Data.(*mm.ChannelList) {
+		if c.Type == mm.CHANNEL_DIRECT {
+			continue
+		}
+		cis = append(cis, mmChannelInfo(c, true))
+	}
+
+	r, err = s.client.GetMoreChannels("")
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range *r.Data.(*mm.ChannelList) {
+		cis = append(cis, mmChannelInfo(c, false))
+	}
+
+	return cis, nil
+}
+
+// ChannelByID implements hugot.ChannelDirectory
+func (s *mma) ChannelByID(ctx context.Context, id string) (*hugot.ChannelInfo, error) {
+	r, err := s.client.GetChannel(id, "")
+	if err != nil {
+		return nil, err
+	}
+	cd := r.Data.(*mm.ChannelData)
+	ci := mmChannelInfo(cd.Channel, cd.Member != nil)
+	return &ci, nil
+}
+
+// ChannelByName implements hugot.ChannelDirectory
+func (s *mma) ChannelByName(ctx context.Context, name string) (*hugot.ChannelInfo, error) {
+	id, err := s.getChannelID(strings.TrimPrefix(name, "~"))
+	if err != nil {
+		return nil, err
+	}
+	return s.ChannelByID(ctx, id)
+}
+
+// JoinChannel implements hugot.ChannelDirectory
+func (s *mma) JoinChannel(ctx context.Context, id string) error {
+	if _, err := s.client.JoinChannel(id); err != nil {
+		return err
+	}
+	return nil
+}
+
+// LeaveChannel implements hugot.ChannelDirectory
+func (s *mma) LeaveChannel(ctx context.Context, id string) error {
+	if _, err := s.client.LeaveChannel(id); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ChannelMembers implements hugot.ChannelDirectory
+func (s *mma) ChannelMembers(ctx context.Context, id string) ([]hugot.UserInfo, error) {
+	r, err := s.client.GetProfilesInChannel(id, 0, 1000, "")
+	if err != nil {
+		return nil, err
+	}
+	us := []hugot.UserInfo{}
+	for _, u := range r.Data.(map[string]*mm.User) {
+		us = append(us, *mmUserInfo(u))
+	}
+	return us, nil
+}
+
+// SetChannelTopic implements hugot.ChannelDirectory, setting the channel
+// header.
+func (s *mma) SetChannelTopic(ctx context.Context, id, topic string) error {
+	data := map[string]string{"channel_id": id, "channel_header": topic}
+	if _, err := s.client.UpdateChannelHeader(data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// PageLimit implements hugot.PageLimiter
+func (s *mma) PageLimit() (int, int) {
+	return 4000, 0
+}
+
 func (s *mma) Send(ctx context.Context, m *hugot.Message) {
+	if _, err := s.Post(ctx, m); err != nil {
+		glog.Infoln(err.Error())
+	}
+}
+
+// Post implements hugot.Editor
+func (s *mma) Post(ctx context.Context, m *hugot.Message) (string, error) {
+	r, err := s.client.CreatePost(mmPost(m))
+	if err != nil {
+		return "", err
+	}
+	return r.Data.(*mm.Post).Id, nil
+}
+
+// Update implements hugot.Editor
+func (s *mma) Update(ctx context.Context, m *hugot.Message) error {
+	post := mmPost(m)
+	post.Id = m.ID
+	if _, err := s.client.UpdatePost(post); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Delete implements hugot.Editor
+func (s *mma) Delete(ctx context.Context, m *hugot.Message) error {
+	if _, err := s.client.DeletePost(m.Channel, m.ID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Upload implements hugot.Uploader
+func (s *mma) Upload(ctx context.Context, m *hugot.Message, f hugot.File) error {
+	data, err := ioutil.ReadAll(f.Reader)
+	if err != nil {
+		return err
+	}
+	r, aerr := s.client.UploadPostAttachment(data, m.Channel, f.Name)
+	if aerr != nil {
+		return aerr
+	}
+
+	post := mmPost(m)
+	for _, fi := range r.FileInfos {
+		post.FileIds = append(post.FileIds, fi.Id)
+	}
+	if _, aerr := s.client.CreatePost(post); aerr != nil {
+		return aerr
+	}
+	return nil
+}
+
+// mmFiles returns the files attached to a post
+func (s *mma) mmFiles(p *mm.Post) []hugot.File {
+	if len(p.FileIds) == 0 {
+		return nil
+	}
+	fis, err := s.client.GetFileInfosForPost(p.ChannelId, p.Id, "")
+	if err != nil {
+		glog.Errorf("could not get files for post %s, %v", p.Id, err)
+		return nil
+	}
+
+	var out []hugot.File
+	for _, fi := range fis {
+		id := fi.Id
+		out = append(out, hugot.File{
+			Name:     fi.Name,
+			MIMEType: fi.MimeType,
+			Reader: hugot.NewLazyReader(func() (io.ReadCloser, error) {
+				r, err := s.client.GetFile(id)
+				if err != nil {
+					return nil, err
+				}
+				return r, nil
+			}),
+		})
+	}
+	return out
+}
+
+// React implements hugot.Reactor
+func (s *mma) React(ctx context.Context, m *hugot.Message, emoji string) error {
+	r := &mm.Reaction{UserId: s.user.Id, PostId: m.ID, EmojiName: emoji}
+	if _, err := s.client.SaveReaction(m.Channel, r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Unreact implements hugot.Reactor
+func (s *mma) Unreact(ctx context.Context, m *hugot.Message, emoji string) error {
+	r := &mm.Reaction{UserId: s.user.Id, PostId: m.ID, EmojiName: emoji}
+	if err := s.client.DeleteReaction(m.Channel, r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Dialect converts hugot markup to mattermost's markdown
+var Dialect = hugot.Dialect{
+	Bold:   func(s string) string { return "**" + s + "**" },
+	Italic: func(s string) string { return "_" + s + "_" },
+	Code:   func(s string) string { return "`" + s + "`" },
+	Pre:    func(s string) string { return "\n```\n" + strings.TrimRight(s, "\n") + "\n```\n" },
+	Link: func(url, text string) string {
+		if text == "" {
+			return url
+		}
+		return "[" + text + "](" + url + ")"
+	},
+	Channel: func(c string) string { return "~" + c },
+}
+
+// Format implements hugot.Formatter
+func (s *mma) Format(markup string) string {
+	return Dialect.Render(markup)
+}
+
+// mmPost converts a hugot message to a mattermost post
+func mmPost(m *hugot.Message) *mm.Post {
 	post := &mm.Post{}
 	post.ChannelId = m.Channel
 	post.Message = m.Text
+	post.RootId = m.ThreadID
+	post.ParentId = m.ThreadID
 	var attchs []map[string]interface{}
 	for _, a := range m.Attachments {
 		switch a.Color {
@@ -128,7 +517,29 @@ func (s *mma) Send(ctx context.Context, m *hugot.Message) {
 			a.Color = "#ff0000"
 		}
 		if a.Fallback == "" {
-			a.Fallback = a.Text
+			a.Fallback = a.PlainText()
+		}
+		txt := []string{}
+		if a.Text != "" {
+			txt = append(txt, a.Text)
+		}
+		for _, sec := range a.Sections {
+			if sec.Title != "" {
+				txt = append(txt, "**"+sec.Title+"**")
+			}
+			if sec.Text != "" {
+				txt = append(txt, sec.Text)
+			}
+			if sec.Code != "" {
+				txt = append(txt, "```"+sec.Language+"\n"+strings.TrimRight(sec.Code, "\n")+"\n```")
+			}
+		}
+		for _, l := range a.Links {
+			if l.Text == "" {
+				txt = append(txt, l.URL)
+				continue
+			}
+			txt = append(txt, "["+l.Text+"]("+l.URL+")")
 		}
 		flds := []map[string]interface{}{}
 		for _, f := range a.Fields {
@@ -140,19 +551,19 @@ func (s *mma) Send(ctx context.Context, m *hugot.Message) {
 		}
 		attchs = append(attchs,
 			map[string]interface{}{
-				"fallback":       a.Fallback,
-				"pretext":        a.Pretext,
-				"text":           a.Text,
-				"title":          a.Title,
-				"title_link":     a.TitleLink,
-				"image_url":      a.ImageURL,
-				"thumb_url":      a.ThumbURL,
-				"color":          a.Color,
-				"author_name":    a.AuthorName,
-				"author_subname": a.AuthorSubname,
-				"author_link":    a.AuthorLink,
-				"author_icon":    a.AuthorIcon,
-				"fields":         flds,
+				"fallback":    a.Fallback,
+				"pretext":     a.Pretext,
+				"text":        strings.Join(txt, "\n"),
+				"title":       a.Title,
+				"title_link":  a.TitleLink,
+				"image_url":   a.ImageURL,
+				"thumb_url":   a.ThumbURL,
+				"color":       a.Color,
+				"author_name": a.AuthorName,
+				"author_link": a.AuthorLink,
+				"author_icon": a.AuthorIcon,
+				"fields":      flds,
+				"footer":      a.Footer,
 			})
 	}
 
@@ -162,9 +573,7 @@ func (s *mma) Send(ctx context.Context, m *hugot.Message) {
 		post.Props["attachments"] = attchs
 	}
 
-	if _, err := s.client.CreatePost(post); err != nil {
-		glog.Infoln(err.Error())
-	}
+	return post
 }
 
 func (s *mma) Receive() <-chan *hugot.Message {
@@ -181,8 +590,74 @@ func (s *mma) Receive() <-chan *hugot.Message {
 				if p == nil || p.UserId == s.user.Id {
 					continue
 				}
+				if p.Type == mm.POST_HEADER_CHANGE {
+					hdr, _ := p.Props["new_header"].(string)
+					out <- s.mmEventToHugot(p.UserId, p.ChannelId, &hugot.Event{Type: hugot.EventTopic, Topic: hdr})
+					return out
+				}
 				out <- s.mmMsgToHugot(m)
 				return out
+			case mm.WEBSOCKET_EVENT_POST_EDITED:
+				p := mm.PostFromJson(strings.NewReader(dataString(m, "post")))
+				if p == nil || p.UserId == s.user.Id {
+					continue
+				}
+				// Edits are not sent with the channel type
+				if _, ok := m.Data["channel_type"]; !ok {
+					if r, err := s.client.GetChannel(p.ChannelId, ""); err == nil {
+						m.Data["channel_type"] = r.Data.(*mm.ChannelData).Channel.Type
+					}
+				}
+				hm := s.mmMsgToHugot(m)
+				if hm == nil {
+					continue
+				}
+				hm.Event = &hugot.Event{Type: hugot.EventEdited, MessageID: p.Id}
+				out <- hm
+				return out
+			case mm.WEBSOCKET_EVENT_POST_DELETED:
+				p := mm.PostFromJson(strings.NewReader(dataString(m, "post")))
+				if p == nil || p.UserId == s.user.Id {
+					continue
+				}
+				out <- s.mmEventToHugot(p.UserId, p.ChannelId, &hugot.Event{Type: hugot.EventDeleted, MessageID: p.Id})
+				return out
+			case mm.WEBSOCKET_EVENT_USER_ADDED:
+				out <- s.mmEventToHugot(dataString(m, "user_id"), m.Broadcast.ChannelId, &hugot.Event{Type: hugot.EventJoin})
+				return out
+			case mm.WEBSOCKET_EVENT_USER_REMOVED:
+				out <- s.mmEventToHugot(dataString(m, "user_id"), m.Broadcast.ChannelId, &hugot.Event{Type: hugot.EventLeave})
+				return out
+			case mm.WEBSOCKET_EVENT_CHANNEL_CREATED:
+				out <- s.mmEventToHugot("", dataString(m, "channel_id"), &hugot.Event{Type: hugot.EventChannelCreated})
+				return out
+			case mm.WEBSOCKET_EVENT_STATUS_CHANGE:
+				if dataString(m, "user_id") == s.user.Id {
+					continue
+				}
+				out <- s.mmEventToHugot(dataString(m, "user_id"), "", &hugot.Event{Type: hugot.EventPresence, Presence: dataString(m, "status")})
+				return out
+			case mm.WEBSOCKET_EVENT_REACTION_ADDED, mm.WEBSOCKET_EVENT_REACTION_REMOVED:
+				rd := dataString(m, "reaction")
+				if rd == "" {
+					glog.Infof("reaction event with no reaction: %#v\n", m)
+					continue
+				}
+				r := mm.ReactionFromJson(strings.NewReader(rd))
+				if r == nil || r.UserId == s.user.Id {
+					continue
+				}
+				out <- &hugot.Message{
+					Channel: m.Broadcast.ChannelId,
+					From:    s.userName(r.UserId),
+					UserID:  r.UserId,
+					Reaction: &hugot.Reaction{
+						Emoji:     r.EmojiName,
+						MessageID: r.PostId,
+						Removed:   m.Event == mm.WEBSOCKET_EVENT_REACTION_REMOVED,
+					},
+				}
+				return out
 			default:
 				glog.Infof("unknown event: %#v\n", m)
 			}
@@ -190,6 +665,81 @@ func (s *mma) Receive() <-chan *hugot.Message {
 	}
 }
 
+// dataString returns the string value of the key in the event's data
+func dataString(e *mm.WebSocketEvent, key string) string {
+	v, _ := e.Data[key].(string)
+	return v
+}
+
+var (
+	mmUserMentionRE    = regexp.MustCompile(`\B@([a-z0-9][a-z0-9._-]*)`)
+	mmChannelMentionRE = regexp.MustCompile(`\B~([a-z0-9][a-z0-9_-]*)`)
+)
+
+// maxMentionLookups bounds the API calls made to resolve the mentions in
+// a single message. Users and channels already seen are resolved from the
+// cache, and do not count.
+const maxMentionLookups = 5
+
+// mentions finds the users and channels mentioned in txt
+func (s *mma) mentions(txt string) []hugot.Mention {
+	var mns []hugot.Mention
+	lookups := 0
+	seen := map[string]bool{}
+	for _, sm := range mmUserMentionRE.FindAllStringSubmatch(txt, -1) {
+		name := strings.TrimRight(sm[1], ".")
+		if seen["@"+name] {
+			continue
+		}
+		seen["@"+name] = true
+
+		u, ok := s.cachedUserByName(name)
+		if !ok {
+			if lookups >= maxMentionLookups {
+				continue
+			}
+			lookups++
+			var err error
+			if u, err = s.getUserByName(name); err != nil {
+				continue
+			}
+		}
+		mns = append(mns, hugot.Mention{Type: hugot.UserMention, ID: u.Id, Name: name})
+	}
+	for _, sm := range mmChannelMentionRE.FindAllStringSubmatch(txt, -1) {
+		name := sm[1]
+		if seen["~"+name] {
+			continue
+		}
+		seen["~"+name] = true
+
+		id, ok := s.cachedChannelID(name)
+		if !ok {
+			if lookups >= maxMentionLookups {
+				continue
+			}
+			lookups++
+			var err error
+			if id, err = s.getChannelID(name); err != nil {
+				continue
+			}
+		}
+		mns = append(mns, hugot.Mention{Type: hugot.ChannelMention, ID: id, Name: name})
+	}
+	return mns
+}
+
+// mmEventToHugot builds a hugot message reporting an event involving the
+// user and channel IDs.
+func (s *mma) mmEventToHugot(user, channel string, e *hugot.Event) *hugot.Message {
+	return &hugot.Message{
+		Channel: channel,
+		From:    s.userName(user),
+		UserID:  user,
+		Event:   e,
+	}
+}
+
 func (s *mma) mmMsgToHugot(me *mm.WebSocketEvent) *hugot.Message {
 	var private, tobot bool
 	if glog.V(3) {
@@ -198,13 +748,11 @@ func (s *mma) mmMsgToHugot(me *mm.WebSocketEvent) *hugot.Message {
 
 	p := mm.PostFromJson(strings.NewReader(me.Data["post"].(string)))
 
-	var uname string
-
-	uname = p.UserId
-	if uname == "" {
-		glog.Infoln("could not resolve username")
+	if p.UserId == "" {
+		glog.Infoln("post has no user")
 		return nil
 	}
+	uname := s.userName(p.UserId)
 
 	ct, ok := me.Data["channel_type"]
 	if !ok {
@@ -230,20 +778,25 @@ func (s *mma) mmMsgToHugot(me *mm.WebSocketEvent) *hugot.Message {
 
 	// Check if the message was sent @bot, if so, set it as to us
 	// and strip the leading politeness
-	dirMatch := s.dirPat.FindStringSubmatch(p.Message)
-	if len(dirMatch) > 1 && len(dirMatch[1]) > 0 {
+	txt := p.Message
+	if t, ok := s.getTrigger().Match(s.BotNames(), txt); ok {
 		tobot = true
-		p.Message = strings.Trim(dirMatch[1], " ")
+		txt = t
 	}
 
 	m := hugot.Message{
-		Channel: p.ChannelId,
-		From:    uname,
-		To:      "",
-		UserID:  p.UserId,
-		Private: private,
-		ToBot:   tobot,
-		Text:    p.Message,
+		ID:       p.Id,
+		ThreadID: p.RootId,
+		Channel:  p.ChannelId,
+		From:     uname,
+		To:       "",
+		UserID:   p.UserId,
+		Private:  private,
+		ToBot:    tobot,
+		Text:     txt,
+		RawText:  p.Message,
+		Files:    s.mmFiles(p),
+		Mentions: s.mentions(txt),
 	}
 
 	if glog.V(3) {
@@ -48,6 +48,37 @@ func New(nick string) (*shell, error) {
 func (s *shell) IsTextOnly() {
 }
 
+// Format implements hugot.Formatter, using ANSI terminal escapes
+func (s *shell) Format(markup string) string {
+	return hugot.ANSIDialect.Render(markup)
+}
+
+// UserByID implements hugot.UserDirectory, using the local user database
+func (s *shell) UserByID(ctx context.Context, id string) (*hugot.UserInfo, error) {
+	u, err := user.LookupId(id)
+	if err != nil {
+		return nil, err
+	}
+	return shellUserInfo(u), nil
+}
+
+// UserByName implements hugot.UserDirectory, using the local user database
+func (s *shell) UserByName(ctx context.Context, name string) (*hugot.UserInfo, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return shellUserInfo(u), nil
+}
+
+func shellUserInfo(u *user.User) *hugot.UserInfo {
+	return &hugot.UserInfo{
+		ID:          u.Uid,
+		Name:        u.Username,
+		DisplayName: u.Name,
+	}
+}
+
 func (s *shell) Send(ctx context.Context, m *hugot.Message) {
 	s.sch <- m
 }
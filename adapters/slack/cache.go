@@ -4,6 +4,7 @@ import (
 	"sync"
 
 	client "github.com/nlopes/slack"
+	"github.com/tcolgate/hugot"
 )
 
 type cache struct {
@@ -41,6 +42,41 @@ func (c *cache) GetUser(id string) (*client.User, error) {
 	return u, nil
 }
 
+// GetUserByName finds a user by name, refreshing the cache from the full
+// list of users if they are not already known.
+func (c *cache) GetUserByName(name string) (*client.User, error) {
+	c.cacheLock.Lock()
+	defer c.cacheLock.Unlock()
+
+	if c.userCache == nil {
+		c.userCache = make(map[string]*client.User)
+	}
+
+	for _, u := range c.userCache {
+		if u.Name == name {
+			return u, nil
+		}
+	}
+
+	us, err := c.api.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *client.User
+	for i := range us {
+		u := &us[i]
+		c.userCache[u.ID] = u
+		if u.Name == name {
+			found = u
+		}
+	}
+	if found == nil {
+		return nil, hugot.ErrUnknownUser
+	}
+	return found, nil
+}
+
 func (c *cache) GetChannel(id string) (*client.Channel, error) {
 	c.cacheLock.Lock()
 	defer c.cacheLock.Unlock()
@@ -22,8 +22,11 @@ package slack
 import (
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 
 	"context"
 
@@ -56,9 +59,11 @@ type slack struct {
 	id   string
 	icon string
 
-	dirPat *regexp.Regexp
-	api    *client.Client
-	info   client.Info
+	triggerLock sync.Mutex
+	trigger     hugot.Trigger
+
+	api  *client.Client
+	info client.Info
 	*cache
 
 	sender   chan *hugot.Message
@@ -68,7 +73,7 @@ type slack struct {
 // New creates a new adapter that communicates with the Slack messaging
 // API. A slack API token, and coresponding bot username must be provided
 func New(token, nick string) (hugot.Adapter, error) {
-	s := slack{nick: nick}
+	s := slack{clientToken: token, nick: nick, trigger: DefaultTrigger}
 	if token == "" {
 		return nil, errors.New("Slack Token must be set")
 	}
@@ -98,8 +103,6 @@ func New(token, nick string) (hugot.Adapter, error) {
 		return nil, errors.New("Could not locate bot's user ID")
 	}
 
-	s.dirPat = regexp.MustCompile(fmt.Sprintf("(?m)^(!|(@?%s|<@%s>)[:,]? )(.*)", s.nick, s.id))
-
 	// We use RTM to recieve, but the regular slack API to send
 	// RTM does not support formatted message parsing
 	wsAPI := s.api.NewRTM()
@@ -111,40 +114,487 @@ func New(token, nick string) (hugot.Adapter, error) {
 	return &s, nil
 }
 
-func (s *slack) IsTextOnly() {
+// DefaultTrigger addresses the bot with a leading ! or mention of the bot
+var DefaultTrigger = hugot.Trigger{Prefixes: []string{"!"}, Mentions: true}
+
+// SetTrigger sets how the adapter decides if a message was sent to the bot.
+func (s *slack) SetTrigger(t hugot.Trigger) {
+	s.triggerLock.Lock()
+	defer s.triggerLock.Unlock()
+
+	s.trigger = t
 }
 
-func (s *slack) Send(ctx context.Context, m *hugot.Message) {
-	if (m.Text != "" || len(m.Attachments) > 0) && m.Channel != "" {
-		var err error
-		chanout := ""
-		c, err := s.GetChannel(m.Channel)
+func (s *slack) getTrigger() hugot.Trigger {
+	s.triggerLock.Lock()
+	defer s.triggerLock.Unlock()
+
+	return s.trigger
+}
+
+// BotNames implements hugot.BotNamer
+func (s *slack) BotNames() []string {
+	return []string{"<@" + s.id + ">", "@" + s.nick, s.nick}
+}
+
+// Dialect converts hugot markup to slack's mrkdwn. Mentions are sent by
+// name, and linked by slack. The adapter's Format method also converts
+// mentions of known users and channels to slack's native syntax.
+var Dialect = hugot.Dialect{
+	Bold:   func(s string) string { return "*" + s + "*" },
+	Italic: func(s string) string { return "_" + s + "_" },
+	Code:   func(s string) string { return "`" + s + "`" },
+	Pre:    func(s string) string { return "```" + s + "```" },
+	Link: func(url, text string) string {
+		if text == "" {
+			return "<" + url + ">"
+		}
+		return "<" + url + "|" + text + ">"
+	},
+}
+
+// Format implements hugot.Formatter
+func (s *slack) Format(markup string) string {
+	d := Dialect
+	d.User = func(u string) string {
+		for _, su := range s.info.Users {
+			if su.Name == u || su.ID == u {
+				return "<@" + su.ID + ">"
+			}
+		}
+		return "@" + u
+	}
+	d.Channel = func(c string) string {
+		for _, sc := range s.info.Channels {
+			if sc.Name == c || sc.ID == c {
+				return "<#" + sc.ID + ">"
+			}
+		}
+		return "#" + c
+	}
+	return d.Render(markup)
+}
+
+var slackMentionRE = regexp.MustCompile(`<([@#])([A-Z0-9]+)(?:\|([^>]*))?>`)
+
+// resolveMentions replaces slack's mentions of users and channels, such as
+// <@U1234>, with their names.
+func (s *slack) resolveMentions(txt string) (string, []hugot.Mention) {
+	var mns []hugot.Mention
+	out := slackMentionRE.ReplaceAllStringFunc(txt, func(str string) string {
+		sm := slackMentionRE.FindStringSubmatch(str)
+		mn := hugot.Mention{ID: sm[2], Name: sm[3]}
+		switch sm[1] {
+		case "@":
+			mn.Type = hugot.UserMention
+			if u, err := s.GetUser(mn.ID); mn.Name == "" && err == nil {
+				mn.Name = u.Name
+			}
+		case "#":
+			mn.Type = hugot.ChannelMention
+			if c := s.info.GetChannelByID(mn.ID); mn.Name == "" && c != nil {
+				mn.Name = c.Name
+			}
+		}
+		if mn.Name == "" {
+			return str
+		}
+		mns = append(mns, mn)
+		return sm[1] + mn.Name
+	})
+	return out, mns
+}
+
+// UserByID implements hugot.UserDirectory
+func (s *slack) UserByID(ctx context.Context, id string) (*hugot.UserInfo, error) {
+	u, err := s.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+	return slackUserInfo(u), nil
+}
+
+// UserByName implements hugot.UserDirectory
+func (s *slack) UserByName(ctx context.Context, name string) (*hugot.UserInfo, error) {
+	u, err := s.GetUserByName(strings.TrimPrefix(name, "@"))
+	if err != nil {
+		return nil, err
+	}
+	return slackUserInfo(u), nil
+}
+
+func slackUserInfo(u *client.User) *hugot.UserInfo {
+	dn := u.Profile.DisplayName
+	if dn == "" {
+		dn = u.RealName
+	}
+	return &hugot.UserInfo{
+		ID:          u.ID,
+		Name:        u.Name,
+		DisplayName: dn,
+		Email:       u.Profile.Email,
+		TimeZone:    u.TZ,
+		IsBot:       u.IsBot,
+	}
+}
+
+func slackChannelInfo(c *client.Channel) *hugot.ChannelInfo {
+	return &hugot.ChannelInfo{
+		ID:     c.ID,
+		Name:   c.Name,
+		Topic:  c.Topic.Value,
+		Member: c.IsMember,
+	}
+}
+
+// slackGroupInfo describes a private group, slack only reports the groups
+// the bot is a member of.
+func slackGroupInfo(g *client.Group) *hugot.ChannelInfo {
+	return &hugot.ChannelInfo{
+		ID:      g.ID,
+		Name:    g.Name,
+		Topic:   g.Topic.Value,
+		Private: true,
+		Member:  true,
+	}
+}
+
+// isGroup returns true if id is that of a private group, which slack
+// manages separately from public channels.
+func isGroup(id string) bool {
+	return strings.HasPrefix(id, "G")
+}
+
+// Channels implements hugot.ChannelDirectory, listing the public channels,
+// and the private groups the bot is in, that are not archived.
+func (s *slack) Channels(ctx context.Context) ([]hugot.ChannelInfo, error) {
+	cs, err := s.api.GetChannels(true)
+	if err != nil {
+		return nil, err
+	}
+	gs, err := s.api.GetGroups(true)
+	if err != nil {
+		return nil, err
+	}
+	cis := make([]hugot.ChannelInfo, 0, len(cs)+len(gs))
+	for i := range cs {
+		cis = append(cis, *slackChannelInfo(&cs[i]))
+	}
+	for i := range gs {
+		cis = append(cis, *slackGroupInfo(&gs[i]))
+	}
+	return cis, nil
+}
+
+// ChannelByID implements hugot.ChannelDirectory
+func (s *slack) ChannelByID(ctx context.Context, id string) (*hugot.ChannelInfo, error) {
+	if isGroup(id) {
+		g, err := s.api.GetGroupInfo(id)
 		if err != nil {
-			glog.Errorf("unresolvable channel, %#v", m.Channel)
-			chanout = m.Channel
-		} else {
-			chanout = c.Name
+			return nil, err
 		}
-		if glog.V(3) {
-			glog.Infof("sending, %#v to %#v", *m, chanout)
+		return slackGroupInfo(g), nil
+	}
+	c, err := s.api.GetChannelInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	return slackChannelInfo(c), nil
+}
+
+// ChannelByName implements hugot.ChannelDirectory. Incoming messages give
+// the channel name in Message.Channel, this finds the ID for it.
+func (s *slack) ChannelByName(ctx context.Context, name string) (*hugot.ChannelInfo, error) {
+	cis, err := s.Channels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	name = strings.TrimPrefix(name, "#")
+	for i := range cis {
+		if cis[i].Name == name {
+			return &cis[i], nil
 		}
+	}
+	return nil, hugot.ErrUnknownChannel
+}
+
+// JoinChannel implements hugot.ChannelDirectory. Slack only lets bots
+// join channels if the adapter was created with a user token, private
+// groups can only be joined by invitation.
+func (s *slack) JoinChannel(ctx context.Context, id string) error {
+	if isGroup(id) {
+		return errors.New("private groups can only be joined by invitation")
+	}
+	c, err := s.api.GetChannelInfo(id)
+	if err != nil {
+		return err
+	}
+	_, err = s.api.JoinChannel(c.Name)
+	return err
+}
+
+// LeaveChannel implements hugot.ChannelDirectory
+func (s *slack) LeaveChannel(ctx context.Context, id string) error {
+	if isGroup(id) {
+		return s.api.LeaveGroup(id)
+	}
+	_, err := s.api.LeaveChannel(id)
+	return err
+}
 
-		p := client.NewPostMessageParameters()
-		p.AsUser = false
-		attchs := []client.Attachment{}
-		for _, a := range m.Attachments {
-			attchs = append(attchs, client.Attachment(a))
+// ChannelMembers implements hugot.ChannelDirectory
+func (s *slack) ChannelMembers(ctx context.Context, id string) ([]hugot.UserInfo, error) {
+	var members []string
+	if isGroup(id) {
+		g, err := s.api.GetGroupInfo(id)
+		if err != nil {
+			return nil, err
 		}
-		p.Attachments = attchs
-		p.Username = s.nick
-		p.IconURL = s.icon // permit overriding this
-		_, _, err = s.api.PostMessage(m.Channel, m.Text, p)
+		members = g.Members
+	} else {
+		c, err := s.api.GetChannelInfo(id)
 		if err != nil {
-			glog.Errorf("error sending, %#v", err.Error())
+			return nil, err
 		}
+		members = c.Members
+	}
+
+	us := []hugot.UserInfo{}
+	for _, uid := range members {
+		u, err := s.GetUser(uid)
+		if err != nil {
+			us = append(us, hugot.UserInfo{ID: uid})
+			continue
+		}
+		us = append(us, *slackUserInfo(u))
+	}
+	return us, nil
+}
+
+// SetChannelTopic implements hugot.ChannelDirectory
+func (s *slack) SetChannelTopic(ctx context.Context, id, topic string) error {
+	var err error
+	if isGroup(id) {
+		_, err = s.api.SetGroupTopic(id, topic)
 	} else {
+		_, err = s.api.SetChannelTopic(id, topic)
+	}
+	return err
+}
+
+// PageLimit implements hugot.PageLimiter, slack truncates long messages
+func (s *slack) PageLimit() (int, int) {
+	return 4000, 0
+}
+
+func (s *slack) Send(ctx context.Context, m *hugot.Message) {
+	if _, err := s.Post(ctx, m); err != nil {
+		glog.Errorf("error sending, %#v", err.Error())
+	}
+}
+
+// Post implements hugot.Editor. Message IDs are formed from the channel ID
+// and timestamp of the message.
+func (s *slack) Post(ctx context.Context, m *hugot.Message) (string, error) {
+	if (m.Text == "" && len(m.Attachments) == 0) || m.Channel == "" {
 		glog.Infoln("Attempt to send empty message")
+		return "", nil
+	}
+
+	chanout := ""
+	c, err := s.GetChannel(m.Channel)
+	if err != nil {
+		glog.Errorf("unresolvable channel, %#v", m.Channel)
+		chanout = m.Channel
+	} else {
+		chanout = c.Name
+	}
+	if glog.V(3) {
+		glog.Infof("sending, %#v to %#v", *m, chanout)
+	}
+
+	p := client.NewPostMessageParameters()
+	p.AsUser = false
+	p.LinkNames = 1
+	if m.ThreadID != "" {
+		_, ts, err := parseMessageID(m.ThreadID)
+		if err != nil {
+			return "", err
+		}
+		p.ThreadTimestamp = ts
+	}
+	attchs := []client.Attachment{}
+	for _, a := range m.Attachments {
+		attchs = append(attchs, slackAttachment(a))
+	}
+	p.Attachments = attchs
+	p.Username = s.nick
+	p.IconURL = s.icon // permit overriding this
+	ch, ts, err := s.api.PostMessage(m.Channel, m.Text, p)
+	if err != nil {
+		return "", err
+	}
+
+	return messageID(ch, ts), nil
+}
+
+// Update implements hugot.Editor
+func (s *slack) Update(ctx context.Context, m *hugot.Message) error {
+	ch, ts, err := parseMessageID(m.ID)
+	if err != nil {
+		return err
 	}
+	_, _, _, err = s.api.UpdateMessage(ch, ts, m.Text)
+	return err
+}
+
+// Delete implements hugot.Editor
+func (s *slack) Delete(ctx context.Context, m *hugot.Message) error {
+	ch, ts, err := parseMessageID(m.ID)
+	if err != nil {
+		return err
+	}
+	_, _, err = s.api.DeleteMessage(ch, ts)
+	return err
+}
+
+// slackAttachment converts a hugot attachment to a slack attachment.
+// Sections and links are rendered into the text using slack's markup.
+func slackAttachment(a hugot.Attachment) client.Attachment {
+	txt := []string{}
+	if a.Text != "" {
+		txt = append(txt, a.Text)
+	}
+	for _, sec := range a.Sections {
+		if sec.Title != "" {
+			txt = append(txt, "*"+sec.Title+"*")
+		}
+		if sec.Text != "" {
+			txt = append(txt, sec.Text)
+		}
+		if sec.Code != "" {
+			txt = append(txt, "```"+strings.TrimRight(sec.Code, "\n")+"```")
+		}
+	}
+	for _, l := range a.Links {
+		if l.Text == "" {
+			txt = append(txt, "<"+l.URL+">")
+			continue
+		}
+		txt = append(txt, "<"+l.URL+"|"+l.Text+">")
+	}
+
+	sa := client.Attachment{
+		Color:      a.Color,
+		Fallback:   a.Fallback,
+		Pretext:    a.Pretext,
+		AuthorName: a.AuthorName,
+		AuthorLink: a.AuthorLink,
+		AuthorIcon: a.AuthorIcon,
+		Title:      a.Title,
+		TitleLink:  a.TitleLink,
+		Text:       strings.Join(txt, "\n"),
+		ImageURL:   a.ImageURL,
+		ThumbURL:   a.ThumbURL,
+		Footer:     a.Footer,
+		MarkdownIn: []string{"text", "pretext", "fields"},
+	}
+	if sa.Fallback == "" {
+		sa.Fallback = a.PlainText()
+	}
+	for _, f := range a.Fields {
+		sa.Fields = append(sa.Fields, client.AttachmentField{
+			Title: f.Title,
+			Value: f.Value,
+			Short: f.Short,
+		})
+	}
+	return sa
+}
+
+// Upload implements hugot.Uploader
+func (s *slack) Upload(ctx context.Context, m *hugot.Message, f hugot.File) error {
+	p := client.FileUploadParameters{
+		Reader:         f.Reader,
+		Filename:       f.Name,
+		Title:          f.Name,
+		InitialComment: m.Text,
+		Channels:       []string{m.Channel},
+	}
+	if m.ThreadID != "" {
+		_, ts, err := parseMessageID(m.ThreadID)
+		if err != nil {
+			return err
+		}
+		p.ThreadTimestamp = ts
+	}
+	_, err := s.api.UploadFile(p)
+	return err
+}
+
+// download fetches the content of a file shared with the bot
+func (s *slack) download(url string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.clientToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error downloading %s, %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// slackFiles converts the files shared in a message to hugot files
+func (s *slack) slackFiles(fs []client.File) []hugot.File {
+	var out []hugot.File
+	for _, f := range fs {
+		url := f.URLPrivateDownload
+		out = append(out, hugot.File{
+			Name:     f.Name,
+			MIMEType: f.Mimetype,
+			URL:      f.URLPrivate,
+			Reader: hugot.NewLazyReader(func() (io.ReadCloser, error) {
+				return s.download(url)
+			}),
+		})
+	}
+	return out
+}
+
+// React implements hugot.Reactor
+func (s *slack) React(ctx context.Context, m *hugot.Message, emoji string) error {
+	ch, ts, err := parseMessageID(m.ID)
+	if err != nil {
+		return err
+	}
+	return s.api.AddReaction(emoji, client.NewRefToMessage(ch, ts))
+}
+
+// Unreact implements hugot.Reactor
+func (s *slack) Unreact(ctx context.Context, m *hugot.Message, emoji string) error {
+	ch, ts, err := parseMessageID(m.ID)
+	if err != nil {
+		return err
+	}
+	return s.api.RemoveReaction(emoji, client.NewRefToMessage(ch, ts))
+}
+
+func messageID(channel, ts string) string {
+	return channel + "/" + ts
+}
+
+func parseMessageID(id string) (string, string, error) {
+	i := strings.Index(id, "/")
+	if i == -1 {
+		return "", "", fmt.Errorf("bad slack message id %q", id)
+	}
+	return id[:i], id[i+1:], nil
 }
 
 func (s *slack) Receive() <-chan *hugot.Message {
@@ -161,10 +611,57 @@ func (s *slack) Receive() <-chan *hugot.Message {
 			case *client.ConnectedEvent:
 				glog.Infof("Connected")
 			case *client.PresenceChangeEvent:
+				m := s.slackEventToHugot(ev.User, "", &hugot.Event{Type: hugot.EventPresence, Presence: ev.Presence})
+				if m == nil {
+					continue
+				}
+				out <- m
+				return out
+			case *client.ChannelCreatedEvent:
+				m := s.slackEventToHugot(ev.Channel.Creator, ev.Channel.ID, &hugot.Event{Type: hugot.EventChannelCreated})
+				if m == nil {
+					continue
+				}
+				out <- m
+				return out
 			case *client.LatencyReport:
 				glog.Infof("Latency: %v", ev.Value)
+			case *client.ReactionAddedEvent:
+				m := s.slackReactionToHugot(*ev, false)
+				if m == nil {
+					continue
+				}
+				out <- m
+				return out
+			case *client.ReactionRemovedEvent:
+				m := s.slackReactionToHugot(client.ReactionAddedEvent(*ev), true)
+				if m == nil {
+					continue
+				}
+				out <- m
+				return out
 			case *client.MessageEvent:
-				m := s.slackMsgToHugot(ev)
+				var m *hugot.Message
+				switch ev.SubType {
+				case "message_changed":
+					m = s.slackEditToHugot(ev)
+				case "message_deleted":
+					m = s.slackDeleteToHugot(ev)
+				}
+				if m != nil {
+					out <- m
+					return out
+				}
+				if e, ok := slackSubTypeEvents[ev.SubType]; ok {
+					e.Topic = ev.Topic
+					m = s.slackEventToHugot(ev.User, ev.Channel, &e)
+					if m == nil {
+						continue
+					}
+					out <- m
+					return out
+				}
+				m = s.slackMsgToHugot(ev)
 				if m == nil {
 					continue
 				}
@@ -177,6 +674,108 @@ func (s *slack) Receive() <-chan *hugot.Message {
 	}
 }
 
+// slackSubTypeEvents maps the subtypes of messages that slack uses to
+// report channel events to hugot events.
+var slackSubTypeEvents = map[string]hugot.Event{
+	"channel_join":  {Type: hugot.EventJoin},
+	"group_join":    {Type: hugot.EventJoin},
+	"channel_leave": {Type: hugot.EventLeave},
+	"group_leave":   {Type: hugot.EventLeave},
+	"channel_topic": {Type: hugot.EventTopic},
+	"group_topic":   {Type: hugot.EventTopic},
+}
+
+// slackEventToHugot builds a hugot message reporting an event involving
+// the user and channel IDs.
+func (s *slack) slackEventToHugot(user, channel string, e *hugot.Event) *hugot.Message {
+	if user == s.id {
+		return nil
+	}
+
+	uname := user
+	if u, err := s.GetUser(user); err == nil {
+		uname = u.Name
+	}
+
+	cname := channel
+	if c := s.info.GetChannelByID(channel); c != nil {
+		cname = c.Name
+	}
+
+	return &hugot.Message{
+		Channel: cname,
+		From:    uname,
+		UserID:  user,
+		Private: channel != "" && !strings.HasPrefix(channel, "C"),
+		Event:   e,
+	}
+}
+
+// slackEditToHugot converts a message_changed event to a hugot message
+// with the new text. Changes that do not alter the text, such as links
+// being unfurled, are ignored.
+func (s *slack) slackEditToHugot(ev *client.MessageEvent) *hugot.Message {
+	if ev.SubMessage == nil {
+		return nil
+	}
+	if ev.PreviousMessage != nil && ev.PreviousMessage.Text == ev.SubMessage.Text {
+		return nil
+	}
+
+	me := &client.MessageEvent{Msg: *ev.SubMessage}
+	me.Channel = ev.Channel
+	m := s.slackMsgToHugot(me)
+	if m == nil {
+		return nil
+	}
+	m.Event = &hugot.Event{Type: hugot.EventEdited, MessageID: m.ID}
+	return m
+}
+
+// slackDeleteToHugot converts a message_deleted event to a hugot event
+func (s *slack) slackDeleteToHugot(ev *client.MessageEvent) *hugot.Message {
+	user := ""
+	if ev.PreviousMessage != nil {
+		user = ev.PreviousMessage.User
+	}
+	return s.slackEventToHugot(user, ev.Channel, &hugot.Event{
+		Type:      hugot.EventDeleted,
+		MessageID: messageID(ev.Channel, ev.DeletedTimestamp),
+	})
+}
+
+// slackReactionToHugot converts a reaction event to a hugot message.
+// Removed reactions are passed as the added event type, they share the
+// same fields.
+func (s *slack) slackReactionToHugot(ev client.ReactionAddedEvent, removed bool) *hugot.Message {
+	if ev.User == s.id || ev.Item.Type != "message" {
+		return nil
+	}
+
+	u, err := s.GetUser(ev.User)
+	if err != nil {
+		glog.Infoln("could not resolve username")
+		return nil
+	}
+
+	cname := ev.Item.Channel
+	if c := s.info.GetChannelByID(ev.Item.Channel); c != nil {
+		cname = c.Name
+	}
+
+	return &hugot.Message{
+		Channel: cname,
+		From:    u.Name,
+		UserID:  ev.User,
+		Private: !strings.HasPrefix(ev.Item.Channel, "C"),
+		Reaction: &hugot.Reaction{
+			Emoji:     ev.Reaction,
+			MessageID: messageID(ev.Item.Channel, ev.Item.Timestamp),
+			Removed:   removed,
+		},
+	}
+}
+
 func (s *slack) slackMsgToHugot(me *client.MessageEvent) *hugot.Message {
 	var private, tobot bool
 	if glog.V(3) {
@@ -233,20 +832,30 @@ func (s *slack) slackMsgToHugot(me *client.MessageEvent) *hugot.Message {
 
 	// Check if the message was sent @bot, if so, set it as to us
 	// and strip the leading politeness
-	dirMatch := s.dirPat.FindStringSubmatch(txt)
-	if len(dirMatch) > 1 && len(dirMatch[1]) > 0 {
+	if t, ok := s.getTrigger().Match(s.BotNames(), txt); ok {
 		tobot = true
-		txt = strings.Trim(dirMatch[3], " ")
+		txt = t
+	}
+	txt, mentions := s.resolveMentions(txt)
+
+	var thread string
+	if me.ThreadTimestamp != "" {
+		thread = messageID(me.Channel, me.ThreadTimestamp)
 	}
 
 	m := hugot.Message{
-		Channel: cname,
-		From:    uname,
-		To:      "",
-		UserID:  me.User,
-		Private: private,
-		ToBot:   tobot,
-		Text:    txt,
+		ID:       messageID(me.Channel, me.Timestamp),
+		ThreadID: thread,
+		Channel:  cname,
+		From:     uname,
+		To:       "",
+		UserID:   me.User,
+		Private:  private,
+		ToBot:    tobot,
+		Text:     txt,
+		RawText:  me.Msg.Text,
+		Files:    s.slackFiles(me.Msg.Files),
+		Mentions: mentions,
 	}
 
 	if m.Private {
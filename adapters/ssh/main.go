@@ -59,6 +59,15 @@ func (a *sshAdpt) Receive() <-chan *hugot.Message {
 	return a.rch
 }
 
+// IsTextOnly implements hugot.TextOnly
+func (a *sshAdpt) IsTextOnly() {
+}
+
+// Format implements hugot.Formatter, using ANSI terminal escapes
+func (a *sshAdpt) Format(markup string) string {
+	return hugot.ANSIDialect.Render(markup)
+}
+
 func (a *sshAdpt) Send(ctx context.Context, m *hugot.Message) {
 	go a.run()
 
@@ -0,0 +1,170 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Attachment represents a block of rich content attached to a message.
+// Adapters render attachments using the native features of their chat
+// system. Messages sent to TextOnly adapters have their attachments
+// rendered as plain text.
+type Attachment struct {
+	Color    string // "good", "warning", "danger", or a hex colour such as "#439FE0"
+	Fallback string // A plain text summary, used where the attachment cannot be shown
+	Pretext  string // Text shown before the attachment
+
+	AuthorName string
+	AuthorLink string
+	AuthorIcon string
+
+	Title     string
+	TitleLink string
+	Text      string
+
+	Fields   []AttachmentField
+	Sections []Section
+	Links    []Link
+
+	ImageURL string
+	ThumbURL string
+
+	Footer string
+}
+
+// AttachmentField is a titled value, short fields may be shown side by
+// side.
+type AttachmentField struct {
+	Title string
+	Value string
+	Short bool
+}
+
+// Section is a titled part of an attachment, with optional code
+type Section struct {
+	Title    string
+	Text     string
+	Code     string // Preformatted text, shown as a code block
+	Language string // The language of Code, if known, for highlighting
+}
+
+// Link is a titled link to a URL
+type Link struct {
+	Text string
+	URL  string
+}
+
+// PlainText renders the attachment as plain text
+func (a Attachment) PlainText() string {
+	buf := &bytes.Buffer{}
+	line := func(f string, args ...interface{}) {
+		fmt.Fprintf(buf, f+"\n", args...)
+	}
+
+	if a.Pretext != "" {
+		line("%s", a.Pretext)
+	}
+	if a.AuthorName != "" {
+		line("%s", a.AuthorName)
+	}
+	switch {
+	case a.Title != "" && a.TitleLink != "":
+		line("%s <%s>", a.Title, a.TitleLink)
+	case a.Title != "":
+		line("%s", a.Title)
+	}
+
+	switch {
+	case a.Text != "":
+		line("%s", a.Text)
+	case a.Fallback != "" && len(a.Fields) == 0 && len(a.Sections) == 0:
+		line("%s", a.Fallback)
+	}
+
+	for _, f := range a.Fields {
+		line("%s: %s", f.Title, f.Value)
+	}
+
+	for _, s := range a.Sections {
+		if s.Title != "" {
+			line("%s", s.Title)
+		}
+		if s.Text != "" {
+			line("%s", s.Text)
+		}
+		if s.Code != "" {
+			line("%s", indent(s.Code, "    "))
+		}
+	}
+
+	for _, l := range a.Links {
+		if l.Text == "" || l.Text == l.URL {
+			line("%s", l.URL)
+			continue
+		}
+		line("%s <%s>", l.Text, l.URL)
+	}
+
+	if a.ImageURL != "" {
+		line("%s", a.ImageURL)
+	}
+	if a.Footer != "" {
+		line("%s", a.Footer)
+	}
+
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+func indent(s, prefix string) string {
+	ls := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i := range ls {
+		ls[i] = prefix + ls[i]
+	}
+	return strings.Join(ls, "\n")
+}
+
+// PlainText renders the text of the message, and any attachments, as
+// plain text.
+func (m *Message) PlainText() string {
+	parts := []string{}
+	if m.Text != "" {
+		parts = append(parts, m.Text)
+	}
+	for _, a := range m.Attachments {
+		if t := a.PlainText(); t != "" {
+			parts = append(parts, t)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// textOnly returns m with any attachments rendered into its text, if s
+// is a TextOnly sender.
+func textOnly(s Sender, m *Message) *Message {
+	if len(m.Attachments) == 0 || !IsTextOnly(s) {
+		return m
+	}
+
+	nm := *m
+	nm.Text = m.PlainText()
+	nm.Attachments = nil
+	return &nm
+}
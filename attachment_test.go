@@ -0,0 +1,43 @@
+package hugot
+
+import (
+	"context"
+	"testing"
+)
+
+type testTextOnlySender struct {
+	testSender
+}
+
+func (ts *testTextOnlySender) IsTextOnly() {
+}
+
+func TestResponseWriter_TextOnly(t *testing.T) {
+	m := &Message{
+		Text: "build finished",
+		Attachments: []Attachment{{
+			Color:     "good",
+			Title:     "build #12",
+			TitleLink: "http://ci/12",
+			Fields:    []AttachmentField{{Title: "Status", Value: "passed", Short: true}},
+			Sections:  []Section{{Title: "Log", Code: "ok  hugot\nok  hugot/bind\n"}},
+			Links:     []Link{{Text: "artifacts", URL: "http://ci/12/artifacts"}},
+		}},
+	}
+	exp := "build finished\nbuild #12 <http://ci/12>\nStatus: passed\nLog\n    ok  hugot\n    ok  hugot/bind\nartifacts <http://ci/12/artifacts>"
+
+	ts := &testTextOnlySender{}
+	newResponseWriter(ts, Message{Channel: "ci"}, "test").Send(context.Background(), m)
+	if len(ts.msgs) != 1 || ts.msgs[0].Text != exp || len(ts.msgs[0].Attachments) != 0 {
+		t.Errorf("expected %q, got %#v", exp, ts.msgs)
+	}
+	if len(m.Attachments) != 1 {
+		t.Errorf("original message should not be modified")
+	}
+
+	rs := &testSender{}
+	newResponseWriter(rs, Message{Channel: "ci"}, "test").Send(context.Background(), m)
+	if len(rs.msgs) != 1 || rs.msgs[0].Text != "build finished" || len(rs.msgs[0].Attachments) != 1 {
+		t.Errorf("expected attachments to be passed to rich adapters, got %#v", rs.msgs)
+	}
+}
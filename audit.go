@@ -0,0 +1,402 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"context"
+
+	"github.com/golang/glog"
+)
+
+// AuditEntry records a single command invocation.
+type AuditEntry struct {
+	Time     time.Time     `json:"time"`
+	Adapter  string        `json:"adapter"`
+	Channel  string        `json:"channel"`
+	User     string        `json:"user"`
+	UserID   string        `json:"user_id"`
+	Args     []string      `json:"args"`    // The parsed command line, pipeline stages are separated by "|"
+	Outcome  string        `json:"outcome"` // One of ok, error, usage, throttled or killed
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// AuditSink receives a record of every command invocation.
+type AuditSink interface {
+	Record(e AuditEntry) error
+}
+
+// AuditQuerier may be implemented by an AuditSink that can retrieve the
+// entries recorded to it.
+type AuditQuerier interface {
+	Recent(n int) ([]AuditEntry, error) // Returns the last n entries, oldest first
+}
+
+// AuditFunc can be used to implement an AuditSink with a plain function.
+type AuditFunc func(e AuditEntry) error
+
+// Record calls f(e)
+func (f AuditFunc) Record(e AuditEntry) error {
+	return f(e)
+}
+
+type fileAuditSink struct {
+	sync.Mutex
+	path string
+	f    *os.File
+}
+
+// NewFileAuditSink creates an AuditSink that appends entries, as lines
+// of JSON, to the file at path. The sink implements io.Closer, and should
+// be closed once no longer needed.
+func NewFileAuditSink(path string) (AuditSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileAuditSink{path: path, f: f}, nil
+}
+
+func (fs *fileAuditSink) Record(e AuditEntry) error {
+	bs, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+	_, err = fs.f.Write(append(bs, '\n'))
+	return err
+}
+
+func (fs *fileAuditSink) Close() error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	return fs.f.Close()
+}
+
+func (fs *fileAuditSink) Recent(n int) ([]AuditEntry, error) {
+	fs.Lock()
+	defer fs.Unlock()
+
+	f, err := os.Open(fs.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var es []AuditEntry
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		e := AuditEntry{}
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			continue
+		}
+		es = append(es, e)
+		if len(es) > n {
+			es = es[1:]
+		}
+	}
+	return es, s.Err()
+}
+
+type storeAuditSink struct {
+	sync.Mutex
+	s   Storer
+	max int
+}
+
+var auditNextKey = []byte("next")
+
+func auditEntryKey(i int) []byte {
+	return []byte("entry#" + strconv.Itoa(i))
+}
+
+// NewStoreAuditSink creates an AuditSink that keeps the last max entries
+// in the provided Storer. Each entry is stored under its own key.
+func NewStoreAuditSink(s Storer, max int) AuditSink {
+	return &storeAuditSink{s: newPrefixedStore([]byte("audit"), s), max: max}
+}
+
+// next returns the sequence number of the next entry to be recorded
+func (ss *storeAuditSink) next() (int, error) {
+	bs, ok, err := ss.s.Get(auditNextKey)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return strconv.Atoi(string(bs))
+}
+
+func (ss *storeAuditSink) Record(e AuditEntry) error {
+	bs, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ss.Lock()
+	defer ss.Unlock()
+
+	i, err := ss.next()
+	if err != nil {
+		return err
+	}
+	if err := ss.s.Set(auditEntryKey(i), bs); err != nil {
+		return err
+	}
+	if err := ss.s.Set(auditNextKey, []byte(strconv.Itoa(i+1))); err != nil {
+		return err
+	}
+	if i >= ss.max {
+		return ss.s.Unset(auditEntryKey(i - ss.max))
+	}
+	return nil
+}
+
+func (ss *storeAuditSink) Recent(n int) ([]AuditEntry, error) {
+	ss.Lock()
+	defer ss.Unlock()
+
+	next, err := ss.next()
+	if err != nil {
+		return nil, err
+	}
+	if n > ss.max {
+		n = ss.max
+	}
+	first := next - n
+	if first < 0 {
+		first = 0
+	}
+
+	var es []AuditEntry
+	for i := first; i < next; i++ {
+		bs, ok, err := ss.s.Get(auditEntryKey(i))
+		if err != nil {
+			return es, err
+		}
+		if !ok {
+			continue
+		}
+		e := AuditEntry{}
+		if err := json.Unmarshal(bs, &e); err != nil {
+			return es, err
+		}
+		es = append(es, e)
+	}
+	return es, nil
+}
+
+// auditLog records entries to a sink, and keeps the most recent entries
+// in memory for sinks that cannot be queried.
+type auditLog struct {
+	sync.Mutex
+	sink   AuditSink
+	admins []string
+	recent []AuditEntry
+}
+
+// maxRecentAudit is the number of entries kept in memory
+const maxRecentAudit = 100
+
+func (al *auditLog) record(e AuditEntry) {
+	al.Lock()
+	defer al.Unlock()
+
+	if err := al.sink.Record(e); err != nil {
+		glog.Errorf("could not record audit entry, %v", err)
+	}
+
+	al.recent = append(al.recent, e)
+	if len(al.recent) > maxRecentAudit {
+		al.recent = al.recent[1:]
+	}
+}
+
+func (al *auditLog) query(n int) ([]AuditEntry, error) {
+	al.Lock()
+	defer al.Unlock()
+
+	if q, ok := al.sink.(AuditQuerier); ok {
+		return q.Recent(n)
+	}
+
+	es := al.recent
+	if len(es) > n {
+		es = es[len(es)-n:]
+	}
+	return append([]AuditEntry{}, es...), nil
+}
+
+// SetAuditSink sets the AuditSink for the DefaultMux
+func SetAuditSink(s AuditSink, admins ...string) {
+	DefaultMux.SetAuditSink(s, admins...)
+}
+
+// SetAuditSink causes all command invocations on this mux to be recorded
+// to s. An "audit" command is added to query recent entries. Users may
+// only see the commands they ran themselves, apart from the admins, who
+// are given by the user ID reported by the adapter.
+func (mx *Mux) SetAuditSink(s AuditSink, admins ...string) {
+	mx.Lock()
+	registered := mx.audit != nil
+	mx.audit = &auditLog{sink: s, admins: admins}
+	mx.Unlock()
+
+	if !registered {
+		mx.HandleCommand(NewCommandHandler("audit", "show recently executed commands", mx.auditCommand, nil))
+	}
+}
+
+// auditOutcome classifies the result of running a command.
+func auditOutcome(err error) string {
+	switch err {
+	case nil, ErrSkipHears:
+		return "ok"
+	case errThrottled:
+		return "throttled"
+	case errKilled:
+		return "killed"
+	}
+	if _, ok := err.(ErrUsage); ok {
+		return "usage"
+	}
+	return "error"
+}
+
+// recordAudit records the invocation of the pipeline stages on behalf of
+// m, if auditing is enabled. Messages that turned out not to be commands
+// are not recorded.
+func (mx *Mux) recordAudit(ctx context.Context, m *Message, stages []pipeStage, start time.Time, err error) {
+	if mx.audit == nil || err == ErrUnknownCommand || err == ErrBadCLI {
+		return
+	}
+
+	var args []string
+	for i, s := range stages {
+		if i > 0 {
+			args = append(args, "|")
+		}
+		args = append(args, s.args...)
+	}
+	if stages == nil {
+		// The command line could not be parsed
+		args = []string{m.Text}
+	}
+
+	e := AuditEntry{
+		Time:     start,
+		Adapter:  AdapterName(ctx),
+		Channel:  m.Channel,
+		User:     m.From,
+		UserID:   m.UserID,
+		Args:     args,
+		Outcome:  auditOutcome(err),
+		Duration: time.Since(start),
+	}
+	if e.Outcome != "ok" && err != nil {
+		e.Error = err.Error()
+	}
+
+	mx.audit.record(e)
+}
+
+// isAdmin checks if the sender of m may see every user's commands
+func (al *auditLog) isAdmin(m *Message) bool {
+	return m.UserID != "" && contains(al.admins, m.UserID)
+}
+
+// ranBy checks if e records a command run by the sender of m
+func ranBy(e AuditEntry, m *Message) bool {
+	if m.UserID != "" || e.UserID != "" {
+		return e.UserID == m.UserID
+	}
+	return e.User == m.From
+}
+
+func (mx *Mux) auditCommand(ctx context.Context, w ResponseWriter, m *Message) error {
+	n := m.Int("n", 10, "number of entries to show")
+	u := m.String("u", "", "only show commands run by this user, admins only")
+	if err := m.Parse(); err != nil {
+		return err
+	}
+	if *n <= 0 {
+		return errors.New("-n must be positive")
+	}
+	mx.RLock()
+	al := mx.audit
+	mx.RUnlock()
+
+	admin := al.isAdmin(m)
+	if *u != "" && !admin {
+		return errors.New("only admins may see the commands of other users")
+	}
+
+	es, err := al.query(maxRecentAudit)
+	if err != nil {
+		return err
+	}
+
+	var out []AuditEntry
+	for _, e := range es {
+		if !admin && !ranBy(e, m) {
+			continue
+		}
+		if *u != "" && e.User != *u && e.UserID != *u {
+			continue
+		}
+		out = append(out, e)
+	}
+	if len(out) > *n {
+		out = out[len(out)-*n:]
+	}
+
+	if len(out) == 0 {
+		fmt.Fprint(w, "no matching commands have been run")
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	tw := new(tabwriter.Writer)
+	tw.Init(buf, 0, 8, 1, ' ', 0)
+	for _, e := range out {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Time.Format(time.RFC3339),
+			e.Channel,
+			e.User,
+			strings.Join(e.Args, " "),
+			e.Outcome,
+			e.Duration.Round(time.Millisecond))
+	}
+	tw.Flush()
+
+	fmt.Fprint(w, buf.String())
+	return nil
+}
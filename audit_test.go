@@ -0,0 +1,139 @@
+package hugot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tcolgate/hugot/storers/memory"
+)
+
+func TestMux_Audit(t *testing.T) {
+	var es []AuditEntry
+	mx := NewMux("test", "")
+	mx.SetAuditSink(AuditFunc(func(e AuditEntry) error {
+		es = append(es, e)
+		return nil
+	}))
+	mx.HandleCommand(NewCommandHandler("fail", "always fails", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		return errors.New("broken")
+	}, nil))
+
+	ts := &testSender{}
+	for _, txt := range []string{`fail -x "a b"`, "nosuchcommand", "help | count"} {
+		m := &Message{Channel: "ops", From: "bob", UserID: "U1", Text: txt, ToBot: true}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+	}
+
+	if len(es) != 2 {
+		t.Fatalf("expected 2 entries, got %#v", es)
+	}
+
+	exp := []struct {
+		args    []string
+		outcome string
+	}{
+		{[]string{"fail", "-x", "a b"}, "error"},
+		{[]string{"help", "|", "count"}, "ok"},
+	}
+	for i, e := range exp {
+		if !reflect.DeepEqual(es[i].Args, e.args) || es[i].Outcome != e.outcome {
+			t.Fatalf("entry %d: expected %v %s, got %v %s", i, e.args, e.outcome, es[i].Args, es[i].Outcome)
+		}
+		if es[i].User != "bob" || es[i].UserID != "U1" || es[i].Channel != "ops" {
+			t.Fatalf("entry %d: bad origin %#v", i, es[i])
+		}
+	}
+}
+
+func TestStoreAuditSink(t *testing.T) {
+	s := NewStoreAuditSink(memory.New(), 2)
+	for _, c := range []string{"a", "b", "c"} {
+		if err := s.Record(AuditEntry{Args: []string{c}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	es, err := s.(AuditQuerier).Recent(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 2 || es[0].Args[0] != "b" || es[1].Args[0] != "c" {
+		t.Fatalf("expected last two entries, got %#v", es)
+	}
+
+	es, err = s.(AuditQuerier).Recent(1)
+	if err != nil || len(es) != 1 || es[0].Args[0] != "c" {
+		t.Fatalf("expected last entry, got %#v, %v", es, err)
+	}
+}
+
+func TestMux_AuditCommand(t *testing.T) {
+	mx := NewMux("test", "")
+	mx.SetAuditSink(AuditFunc(func(e AuditEntry) error { return nil }), "U9")
+	mx.HandleCommand(NewCommandHandler("secret", "a private command", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		return nil
+	}, nil))
+
+	run := func(from, id, txt string) string {
+		ts := &testSender{}
+		m := &Message{Channel: "ops", From: from, UserID: id, Text: txt, ToBot: true}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+		return strings.Join(ts.texts(), "\n")
+	}
+
+	run("bob", "U1", "secret bob")
+	run("alice", "U2", "secret alice")
+
+	if out := run("bob", "U1", "audit"); !strings.Contains(out, "secret bob") || strings.Contains(out, "secret alice") {
+		t.Errorf("expected only bob's commands, got %q", out)
+	}
+	if out := run("alice", "U1", "audit"); strings.Contains(out, "secret alice") {
+		t.Errorf("user name should not identify the caller, got %q", out)
+	}
+	if out := run("bob", "U1", "audit -u alice"); !strings.Contains(out, "only admins") {
+		t.Errorf("expected -u to be refused, got %q", out)
+	}
+	if out := run("root", "U9", "audit"); !strings.Contains(out, "secret bob") || !strings.Contains(out, "secret alice") {
+		t.Errorf("expected admin to see all commands, got %q", out)
+	}
+}
+
+func TestFileAuditSink(t *testing.T) {
+	f, err := ioutil.TempFile("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	s, err := NewFileAuditSink(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []string{"a", "b", "c"} {
+		if err := s.Record(AuditEntry{Args: []string{c}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	es, err := s.(AuditQuerier).Recent(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 2 || es[0].Args[0] != "b" || es[1].Args[0] != "c" {
+		t.Fatalf("expected last two entries, got %#v", es)
+	}
+
+	if err := s.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Record(AuditEntry{}); err == nil {
+		t.Fatal("expected an error recording to a closed sink")
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NamedGroups returns the named capture groups of the first of submatches,
+// as passed to a HearsHandler by rgxp. Groups that did not take part in
+// the match are omitted.
+func NamedGroups(rgxp *regexp.Regexp, submatches [][]string) map[string]string {
+	groups := map[string]string{}
+	if len(submatches) == 0 {
+		return groups
+	}
+
+	for i, n := range rgxp.SubexpNames() {
+		if n == "" || i >= len(submatches[0]) || submatches[0][i] == "" {
+			continue
+		}
+		groups[n] = submatches[0][i]
+	}
+	return groups
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Bind sets the fields of the struct pointed to by v from groups, such as
+// those returned by NamedGroups. A field is set from the group named by its
+// `hugot` struct tag, or otherwise from the group matching its name,
+// ignoring case. Fields may be strings, bools, integers, floats or
+// time.Durations. Fields with no matching group are left untouched.
+func Bind(groups map[string]string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("Bind requires a pointer to a struct")
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	lgroups := map[string]string{}
+	for k, s := range groups {
+		lgroups[strings.ToLower(k)] = s
+	}
+
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+
+		var s string
+		var ok bool
+		if n := f.Tag.Get("hugot"); n != "" {
+			s, ok = groups[n]
+		} else {
+			s, ok = lgroups[strings.ToLower(f.Name)]
+		}
+		if !ok {
+			continue
+		}
+
+		if err := setField(rv.Field(i), s); err != nil {
+			return fmt.Errorf("%s: %v", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func setField(fv reflect.Value, s string) error {
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
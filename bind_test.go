@@ -0,0 +1,34 @@
+package hugot
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestNamedGroupsBind(t *testing.T) {
+	rx := regexp.MustCompile(`deploy (?P<app>\w+)(?: to (?P<env>\w+))?(?: x(?P<count>\d+))?(?: in (?P<wait>\w+))?`)
+	groups := NamedGroups(rx, rx.FindAllStringSubmatch("please deploy web x3 in 5m", -1))
+	if exp := map[string]string{"app": "web", "count": "3", "wait": "5m"}; !reflect.DeepEqual(groups, exp) {
+		t.Fatalf("expected %v, got %v", exp, groups)
+	}
+
+	var args struct {
+		App      string
+		Env      string
+		Count    int
+		Duration time.Duration `hugot:"wait"`
+	}
+	args.Env = "staging"
+	if err := Bind(groups, &args); err != nil {
+		t.Fatal(err)
+	}
+	if args.App != "web" || args.Env != "staging" || args.Count != 3 || args.Duration != 5*time.Minute {
+		t.Fatalf("bad binding %#v", args)
+	}
+
+	if err := Bind(map[string]string{"count": "lots"}, &args); err == nil {
+		t.Fatal("expected an error binding a bad int")
+	}
+}
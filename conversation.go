@@ -0,0 +1,228 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"context"
+
+	"github.com/golang/glog"
+)
+
+// ConversationValues holds the answers collected during a conversation.
+// They are persisted between steps.
+type ConversationValues map[string]string
+
+// ConversationFunc describes the calling convention for a step of a
+// conversation. It is called with the user's reply to the state's prompt,
+// and returns the name of the next state, or "" if the conversation is
+// complete. Returning an error reports it to the user and repeats the
+// current state.
+type ConversationFunc func(ctx context.Context, w ResponseWriter, m *Message, vs ConversationValues) (string, error)
+
+// ConversationState describes a single step of a conversation.
+type ConversationState struct {
+	Prompt string           // Sent to the user when the state is entered
+	Next   ConversationFunc // Called with the user's reply
+}
+
+// ConversationHandler handlers implement multi-step conversations, such as
+// wizards. The conversation is started by running the handler's name as a
+// command, after which all messages from that user, in that channel, are
+// routed to the conversation until it completes, or the user says "cancel".
+type ConversationHandler interface {
+	Handler
+	StartState() string                          // The name of the first state
+	State(name string) (ConversationState, bool) // Returns the named state
+}
+
+type baseConversationHandler struct {
+	Handler
+	start  string
+	states map[string]ConversationState
+}
+
+// NewConversationHandler creates a ConversationHandler with the given name
+// and description. The conversation begins in the start state.
+func NewConversationHandler(name, desc, start string, states map[string]ConversationState) ConversationHandler {
+	return &baseConversationHandler{
+		Handler: newBaseHandler(name, desc),
+		start:   start,
+		states:  states,
+	}
+}
+
+func (bch *baseConversationHandler) StartState() string {
+	return bch.start
+}
+
+func (bch *baseConversationHandler) State(name string) (ConversationState, bool) {
+	s, ok := bch.states[name]
+	return s, ok
+}
+
+// conversation is the persisted state of an active conversation.
+type conversation struct {
+	Handler string             `json:"handler"`
+	State   string             `json:"state"`
+	Values  ConversationValues `json:"values"`
+}
+
+// conversationKey identifies the conversation a message belongs to.
+func conversationKey(m *Message) []byte {
+	return []byte(m.Channel + "#" + m.UserKey())
+}
+
+func (mx *Mux) conversationStore() Storer {
+	return newPrefixedStore([]byte("conversation"), mx.store)
+}
+
+func (mx *Mux) loadConversation(m *Message) (*conversation, error) {
+	bs, ok, err := mx.conversationStore().Get(conversationKey(m))
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	c := &conversation{}
+	if err := json.Unmarshal(bs, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (mx *Mux) saveConversation(m *Message, c *conversation) error {
+	bs, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return mx.conversationStore().Set(conversationKey(m), bs)
+}
+
+func (mx *Mux) endConversation(m *Message) error {
+	return mx.conversationStore().Unset(conversationKey(m))
+}
+
+// enterState saves the conversation c as being in state s, and prompts
+// the user.
+func (mx *Mux) enterState(w ResponseWriter, m *Message, h ConversationHandler, c *conversation, s string) error {
+	st, ok := h.State(s)
+	if !ok {
+		mx.endConversation(m)
+		return fmt.Errorf("conversation %s has no state %s", c.Handler, s)
+	}
+
+	c.State = s
+	if err := mx.saveConversation(m, c); err != nil {
+		return err
+	}
+
+	if st.Prompt != "" {
+		fmt.Fprint(w, st.Prompt)
+	}
+	return nil
+}
+
+// isCommand returns true if the first word of m is the name of a command
+func (mx *Mux) isCommand(m *Message) bool {
+	ws := strings.Fields(m.Text)
+	if len(ws) == 0 {
+		return false
+	}
+	_, ok := (*mx.cmds)[ws[0]]
+	return ok
+}
+
+// converse passes m to any active conversation for the sending user. It
+// returns false if there is no active conversation.
+func (mx *Mux) converse(ctx context.Context, w ResponseWriter, m *Message) (bool, error) {
+	c, err := mx.loadConversation(m)
+	if err != nil {
+		glog.Errorf("could not load conversation, %v", err)
+		return false, nil
+	}
+	if c == nil {
+		return false, nil
+	}
+
+	h, ok := mx.convs[c.Handler]
+	if !ok {
+		// The handler has gone away, probably over a restart.
+		mx.endConversation(m)
+		return false, nil
+	}
+
+	// Commands sent to the bot, such as help, are not captured by the
+	// conversation.
+	if m.ToBot && mx.isCommand(m) {
+		return false, nil
+	}
+
+	if strings.EqualFold(strings.TrimSpace(m.Text), "cancel") {
+		fmt.Fprintf(w, "ok, %s cancelled", c.Handler)
+		return true, mx.endConversation(m)
+	}
+
+	st, ok := h.State(c.State)
+	if !ok || st.Next == nil {
+		mx.endConversation(m)
+		return true, fmt.Errorf("conversation %s has no state %s", c.Handler, c.State)
+	}
+
+	if c.Values == nil {
+		c.Values = ConversationValues{}
+	}
+
+	next, err := st.Next(ctx, w, m, c.Values)
+	if err != nil {
+		fmt.Fprintf(w, "error, %s", err.Error())
+		return true, mx.enterState(w, m, h, c, c.State)
+	}
+
+	if next == "" {
+		return true, mx.endConversation(m)
+	}
+
+	return true, mx.enterState(w, m, h, c, next)
+}
+
+// conversationStarter is the command used to start a conversation.
+type conversationStarter struct {
+	mx *Mux
+	h  ConversationHandler
+}
+
+func (cs *conversationStarter) Describe() (string, string) {
+	return cs.h.Describe()
+}
+
+func (cs *conversationStarter) Command(ctx context.Context, w ResponseWriter, m *Message) error {
+	if err := m.Parse(); err != nil {
+		return err
+	}
+
+	n, _ := cs.h.Describe()
+	c := &conversation{
+		Handler: n,
+		Values:  ConversationValues{},
+	}
+
+	return cs.mx.enterState(w, m, cs.h, c, cs.h.StartState())
+}
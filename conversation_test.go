@@ -0,0 +1,129 @@
+package hugot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testSender struct {
+	sync.Mutex
+	msgs []Message
+}
+
+func (ts *testSender) Send(ctx context.Context, m *Message) {
+	ts.Lock()
+	defer ts.Unlock()
+	ts.msgs = append(ts.msgs, *m)
+}
+
+func (ts *testSender) texts() []string {
+	ts.Lock()
+	defer ts.Unlock()
+	var out []string
+	for _, m := range ts.msgs {
+		out = append(out, m.Text)
+	}
+	return out
+}
+
+func newTestIncident(done chan ConversationValues) ConversationHandler {
+	return NewConversationHandler("incident", "file an incident", "title", map[string]ConversationState{
+		"title": {
+			Prompt: "title?",
+			Next: func(ctx context.Context, w ResponseWriter, m *Message, vs ConversationValues) (string, error) {
+				vs["title"] = m.Text
+				return "severity", nil
+			},
+		},
+		"severity": {
+			Prompt: "severity?",
+			Next: func(ctx context.Context, w ResponseWriter, m *Message, vs ConversationValues) (string, error) {
+				if m.Text != "high" && m.Text != "low" {
+					return "", errors.New("severity must be high or low")
+				}
+				vs["severity"] = m.Text
+				done <- vs
+				return "", nil
+			},
+		},
+	})
+}
+
+func TestConversation(t *testing.T) {
+	done := make(chan ConversationValues, 1)
+	mx := NewMux("test", "")
+	mx.HandleConversation(newTestIncident(done))
+
+	ts := &testSender{}
+	say := func(txt string, tobot bool) {
+		m := &Message{Channel: "ops", From: "bob", Text: txt, ToBot: tobot}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+	}
+
+	say("incident", true)
+	say("database on fire", false)
+	say("medium", false)
+	say("high", false)
+
+	select {
+	case vs := <-done:
+		if vs["title"] != "database on fire" || vs["severity"] != "high" {
+			t.Fatalf("unexpected values %#v", vs)
+		}
+	default:
+		t.Fatalf("conversation did not complete, got %#v", ts.texts())
+	}
+
+	exp := []string{"title?", "severity?", "error, severity must be high or low", "severity?"}
+	got := ts.texts()
+	if len(got) != len(exp) {
+		t.Fatalf("expected %#v, got %#v", exp, got)
+	}
+	for i := range exp {
+		if got[i] != exp[i] {
+			t.Fatalf("expected %#v, got %#v", exp, got)
+		}
+	}
+
+	if c, _ := mx.loadConversation(&Message{Channel: "ops", From: "bob"}); c != nil {
+		t.Fatalf("conversation still active, %#v", c)
+	}
+}
+
+func TestConversation_Cancel(t *testing.T) {
+	mx := NewMux("test", "")
+	mx.HandleConversation(newTestIncident(make(chan ConversationValues, 1)))
+
+	ts := &testSender{}
+	for _, txt := range []string{"incident", "cancel"} {
+		m := &Message{Channel: "ops", From: "bob", Text: txt, ToBot: true}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+	}
+
+	if c, _ := mx.loadConversation(&Message{Channel: "ops", From: "bob"}); c != nil {
+		t.Fatalf("conversation still active after cancel, %#v", c)
+	}
+}
+
+func TestConversation_Commands(t *testing.T) {
+	mx := NewMux("test", "")
+	mx.HandleConversation(newTestIncident(make(chan ConversationValues, 1)))
+
+	ts := &testSender{}
+	say := func(txt string, tobot bool) {
+		m := &Message{Channel: "ops", From: "bob", Text: txt, ToBot: tobot}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+	}
+
+	say("incident", true)
+	say("help", true)
+	say("database on fire", false)
+
+	got := ts.texts()
+	if len(got) != 3 || got[0] != "title?" || !strings.Contains(got[1], "file an incident") || got[2] != "severity?" {
+		t.Fatalf("expected help to run during the conversation, got %q", got)
+	}
+}
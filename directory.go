@@ -0,0 +1,143 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"errors"
+	"strings"
+
+	"context"
+)
+
+var (
+	// ErrNoUserDirectory is returned when looking up users via an adapter
+	// that does not support it.
+	ErrNoUserDirectory = errors.New("adapter does not support user lookups")
+
+	// ErrUnknownUser is returned by a UserDirectory when the user cannot
+	// be found.
+	ErrUnknownUser = errors.New("unknown user")
+
+	// ErrNoChannelDirectory is returned when looking up channels via an
+	// adapter that does not support it.
+	ErrNoChannelDirectory = errors.New("adapter does not support channel lookups")
+
+	// ErrUnknownChannel is returned by a ChannelDirectory when the channel
+	// cannot be found.
+	ErrUnknownChannel = errors.New("unknown channel")
+)
+
+// UserInfo describes a user of the chat system. Adapters fill in as much
+// as their chat system makes available.
+type UserInfo struct {
+	ID          string // The adapter's identifier for the user, as in Message.UserID
+	Name        string // The user's name, as in Message.From
+	DisplayName string // The user's full, or preferred, name
+	Email       string
+	TimeZone    string // An IANA time zone name, e.g. "Europe/London"
+	IsBot       bool
+}
+
+// UserDirectory is implemented by adapters that can look up details of
+// users.
+type UserDirectory interface {
+	UserByID(ctx context.Context, id string) (*UserInfo, error)
+	UserByName(ctx context.Context, name string) (*UserInfo, error)
+}
+
+// UserDirectoryFromContext returns the UserDirectory of the adapter
+// stored in ctx, if it has one.
+func UserDirectoryFromContext(ctx context.Context) (UserDirectory, bool) {
+	a, ok := AdapterFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	ud, ok := a.(UserDirectory)
+	return ud, ok
+}
+
+// LookupUser finds the user, given by ID or name, using the adapter
+// stored in ctx.
+func LookupUser(ctx context.Context, user string) (*UserInfo, error) {
+	ud, ok := UserDirectoryFromContext(ctx)
+	if !ok {
+		return nil, ErrNoUserDirectory
+	}
+	if u, err := ud.UserByID(ctx, user); err == nil {
+		return u, nil
+	}
+	return ud.UserByName(ctx, user)
+}
+
+// FromUser looks up the user that sent m, using the adapter stored in ctx.
+func (m *Message) FromUser(ctx context.Context) (*UserInfo, error) {
+	ud, ok := UserDirectoryFromContext(ctx)
+	if !ok {
+		return nil, ErrNoUserDirectory
+	}
+	if m.UserID != "" {
+		return ud.UserByID(ctx, m.UserID)
+	}
+	return ud.UserByName(ctx, m.From)
+}
+
+// ChannelInfo describes a channel of the chat system
+type ChannelInfo struct {
+	ID      string // The adapter's identifier for the channel
+	Name    string // The name of the channel, without any leading #. Some adapters, such as Slack, use this as Message.Channel
+	Topic   string
+	Private bool
+	Member  bool // True if the bot is a member of the channel
+}
+
+// ChannelDirectory is implemented by adapters that can list channels, and
+// manage the bot's membership of them. Channels are identified by their
+// ID.
+type ChannelDirectory interface {
+	Channels(ctx context.Context) ([]ChannelInfo, error) // The channels visible to the bot
+	ChannelByID(ctx context.Context, id string) (*ChannelInfo, error)
+	ChannelByName(ctx context.Context, name string) (*ChannelInfo, error)
+	JoinChannel(ctx context.Context, id string) error
+	LeaveChannel(ctx context.Context, id string) error
+	ChannelMembers(ctx context.Context, id string) ([]UserInfo, error)
+	SetChannelTopic(ctx context.Context, id, topic string) error
+}
+
+// ChannelDirectoryFromContext returns the ChannelDirectory of the adapter
+// stored in ctx, if it has one.
+func ChannelDirectoryFromContext(ctx context.Context) (ChannelDirectory, bool) {
+	a, ok := AdapterFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	cd, ok := a.(ChannelDirectory)
+	return cd, ok
+}
+
+// LookupChannel finds the channel, given by ID or name, using the adapter
+// stored in ctx. A leading # on the name is ignored.
+func LookupChannel(ctx context.Context, channel string) (*ChannelInfo, error) {
+	cd, ok := ChannelDirectoryFromContext(ctx)
+	if !ok {
+		return nil, ErrNoChannelDirectory
+	}
+	if c, err := cd.ChannelByID(ctx, channel); err == nil {
+		return c, nil
+	}
+	return cd.ChannelByName(ctx, strings.TrimPrefix(channel, "#"))
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"context"
+	"testing"
+)
+
+type testDirectoryAdapter struct {
+	testAdapter
+	users []UserInfo
+}
+
+func (ta *testDirectoryAdapter) UserByID(ctx context.Context, id string) (*UserInfo, error) {
+	for _, u := range ta.users {
+		if u.ID == id {
+			return &u, nil
+		}
+	}
+	return nil, ErrUnknownUser
+}
+
+func (ta *testDirectoryAdapter) UserByName(ctx context.Context, name string) (*UserInfo, error) {
+	for _, u := range ta.users {
+		if u.Name == name {
+			return &u, nil
+		}
+	}
+	return nil, ErrUnknownUser
+}
+
+func TestLookupUser(t *testing.T) {
+	ta := &testDirectoryAdapter{
+		users: []UserInfo{
+			{ID: "U1", Name: "bob", DisplayName: "Bob", TimeZone: "Europe/London"},
+			{ID: "U2", Name: "alice", DisplayName: "Alice"},
+		},
+	}
+	ctx := NewAdapterContext(context.Background(), ta)
+
+	tests := []struct {
+		user string
+		exp  string
+		err  error
+	}{
+		{"U1", "bob", nil},
+		{"alice", "alice", nil},
+		{"carol", "", ErrUnknownUser},
+	}
+
+	for _, tt := range tests {
+		u, err := LookupUser(ctx, tt.user)
+		if err != tt.err {
+			t.Errorf("LookupUser(%q) error = %v, expected %v", tt.user, err, tt.err)
+			continue
+		}
+		if err == nil && u.Name != tt.exp {
+			t.Errorf("LookupUser(%q) = %q, expected %q", tt.user, u.Name, tt.exp)
+		}
+	}
+
+	m := &Message{From: "bob", UserID: "U1"}
+	if u, err := m.FromUser(ctx); err != nil || u.TimeZone != "Europe/London" {
+		t.Errorf("FromUser() = %v, %v", u, err)
+	}
+
+	ctx = NewAdapterContext(context.Background(), &testAdapter{})
+	if _, err := LookupUser(ctx, "bob"); err != ErrNoUserDirectory {
+		t.Errorf("expected ErrNoUserDirectory, got %v", err)
+	}
+}
@@ -17,8 +17,8 @@
 
 // Package hugot provides a simple interface for building extensible
 // chat bots in an idiomatic go style. It is heavily influenced by
-// net/http, and uses an internal message format that is compatible
-// with Slack messages.
+// net/http, and uses an internal message format that each adapter renders
+// natively.
 //
 // Note: This package requires go1.7
 //
@@ -34,6 +34,26 @@
 //
 // Examples of using these adapters can be found in github.com/tcolgate/hugot/cmd
 //
+// Adapters decide if a message was sent to the bot using a Trigger, such as a
+// leading mention of the bot's name, or a "!" prefix. The Mux can override
+// this for all channels, or for individual channels.
+//
+// Handlers may format text using a neutral markup, built with Bold, Italic,
+// Code, Pre, LinkTo, MentionUser and MentionChannel. Adapters that implement
+// Formatter convert it to their own dialect, such as Slack mrkdwn, or IRC
+// control codes. Other adapters receive plain text.
+//
+// Adapters list the users and channels mentioned in incoming messages in
+// the message's Mentions. Handlers can check whether a user was mentioned
+// using Message.Mentioned.
+//
+// Adapters that implement UserDirectory can look up details of users, such
+// as their display name, email and time zone. Handlers can use LookupUser,
+// or Message.FromUser, with the context they are passed. Adapters that
+// implement ChannelDirectory can list channels, and join, leave, and set
+// the topic of channels. The handlers/channels package provides commands
+// to manage them.
+//
 // Handlers
 //
 // Handlers process messages. There are a several built in handler types:
@@ -54,11 +74,35 @@
 // WebHook handlers can be used to implement web hooks by adding the bot to a
 // http.ServeMux. A URL is build from the name of the handler.
 //
+// Conversation handlers implement multi-step dialogues, such as wizards. Once
+// started, all messages from a user in a channel are routed to the
+// conversation until it completes, or the user says "cancel". Commands
+// sent to the bot are still run. Progress is persisted via the Mux's
+// Storer.
+//
+// Reaction handlers are called when users add, or remove, emoji reactions
+// to messages. Handlers can react to messages themselves using React, on
+// adapters that implement Reactor.
+//
+// Event handlers are called for other chat events, such as users joining or
+// leaving channels, topic changes, new channels, and changes in presence.
+// Edited and deleted messages are also reported as events. Commands can opt
+// in to being run again when edited, using SetRerunOnEdit.
+//
 // Mux
 //
 // The Mux will multiplex message across a set of handlers. In addition, a top
 // level "help" Command handler is added to provide help on usage of the
 // various handlers added to the Mux.
 //
+// Each command run by the Mux is tracked as a job, with its own context.
+// The "jobs" command lists running jobs, and "kill" cancels a job's context.
+// Users are told when a job that has run for longer than the SetJobNotify
+// duration finishes.
+//
+// Handlers can send files with Upload, or by adding Files to a message.
+// For adapters that cannot upload files, the Mux serves the file from its
+// web handler for a while, and sends a link instead.
+//
 // WARNING: The API is still subject to change.
 package hugot
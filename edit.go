@@ -0,0 +1,169 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"fmt"
+	"sync"
+
+	"context"
+)
+
+// Editor is implemented by adapters, and ResponseWriters, that can
+// identify the messages they send, and later update or delete them.
+type Editor interface {
+	Post(ctx context.Context, m *Message) (string, error) // Sends m, returning its ID
+	Update(ctx context.Context, m *Message) error         // Replaces the message identified by m.ID
+	Delete(ctx context.Context, m *Message) error         // Removes the message identified by m.ID
+}
+
+// Post sends txt via w, returning an ID that can be used to Update or
+// Delete the message. The ID is empty if w cannot edit messages.
+func Post(ctx context.Context, w ResponseWriter, txt string) (string, error) {
+	if e, ok := w.(Editor); ok {
+		return e.Post(ctx, &Message{Text: txt})
+	}
+
+	_, err := fmt.Fprint(w, txt)
+	return "", err
+}
+
+// Update replaces the text of the message id, previously sent with Post.
+// If the message cannot be edited, txt is sent as a new message.
+func Update(ctx context.Context, w ResponseWriter, id, txt string) error {
+	if e, ok := w.(Editor); ok && id != "" {
+		return e.Update(ctx, &Message{ID: id, Text: txt})
+	}
+
+	_, err := fmt.Fprint(w, txt)
+	return err
+}
+
+// Delete removes the message id, previously sent with Post. Nothing is
+// done if the message cannot be deleted.
+func Delete(ctx context.Context, w ResponseWriter, id string) error {
+	if e, ok := w.(Editor); ok && id != "" {
+		return e.Delete(ctx, &Message{ID: id})
+	}
+	return nil
+}
+
+// outbound builds a message to send from m, using the writer's channel
+// and user if m does not specify them.
+func (w *responseWriter) outbound(m *Message) *Message {
+	nmsg := w.msg
+	nmsg.ID = m.ID
+	nmsg.Text = m.Text
+	nmsg.Attachments = m.Attachments
+	nmsg.Files = m.Files
+	if m.Channel != "" {
+		nmsg.Channel = m.Channel
+	}
+	if m.To != "" {
+		nmsg.To = m.To
+	}
+	return &nmsg
+}
+
+// Post implements Editor. If the adapter cannot edit messages, m is sent
+// and an empty ID is returned.
+func (w *responseWriter) Post(ctx context.Context, m *Message) (string, error) {
+	nmsg := w.outbound(m)
+	nmsg.ID = ""
+	if e, ok := w.snd.(Editor); ok {
+		messagesTx.WithLabelValues(w.an, nmsg.Channel, nmsg.From).Inc()
+		return e.Post(ctx, Format(w.snd, nmsg))
+	}
+
+	w.Send(ctx, nmsg)
+	return "", nil
+}
+
+// Update implements Editor. If the adapter cannot edit messages, m is
+// sent as a new message.
+func (w *responseWriter) Update(ctx context.Context, m *Message) error {
+	nmsg := w.outbound(m)
+	if e, ok := w.snd.(Editor); ok && nmsg.ID != "" {
+		return e.Update(ctx, Format(w.snd, nmsg))
+	}
+
+	nmsg.ID = ""
+	w.Send(ctx, nmsg)
+	return nil
+}
+
+// Delete implements Editor. Nothing is done if the adapter cannot delete
+// messages.
+func (w *responseWriter) Delete(ctx context.Context, m *Message) error {
+	nmsg := w.outbound(m)
+	if e, ok := w.snd.(Editor); ok && nmsg.ID != "" {
+		return e.Delete(ctx, nmsg)
+	}
+	return nil
+}
+
+// Progress is an io.Writer that reports progress by repeatedly editing a
+// single message. If the adapter cannot edit messages, each Write sends a
+// new message.
+type Progress struct {
+	ctx context.Context
+	w   ResponseWriter
+
+	sync.Mutex
+	id string
+}
+
+// NewProgress creates a Progress that sends its messages via w.
+func NewProgress(ctx context.Context, w ResponseWriter) *Progress {
+	return &Progress{ctx: ctx, w: w}
+}
+
+// Write replaces the content of the progress message with bs.
+func (p *Progress) Write(bs []byte) (int, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	var err error
+	if p.id == "" {
+		p.id, err = Post(p.ctx, p.w, string(bs))
+	} else {
+		err = Update(p.ctx, p.w, p.id, string(bs))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(bs), nil
+}
+
+// Printf replaces the content of the progress message with the formatted
+// text.
+func (p *Progress) Printf(f string, args ...interface{}) error {
+	_, err := fmt.Fprintf(p, f, args...)
+	return err
+}
+
+// Clear deletes the progress message, if possible. Any further writes
+// will send a new message.
+func (p *Progress) Clear() error {
+	p.Lock()
+	defer p.Unlock()
+
+	id := p.id
+	p.id = ""
+	return Delete(p.ctx, p.w, id)
+}
@@ -0,0 +1,65 @@
+package hugot
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type testEditor struct {
+	testSender
+	next int
+	live map[string]string
+}
+
+func (te *testEditor) Post(ctx context.Context, m *Message) (string, error) {
+	te.next++
+	id := fmt.Sprintf("m%d", te.next)
+	te.live[id] = m.Channel + ":" + m.Text
+	return id, nil
+}
+
+func (te *testEditor) Update(ctx context.Context, m *Message) error {
+	te.live[m.ID] = m.Channel + ":" + m.Text
+	return nil
+}
+
+func (te *testEditor) Delete(ctx context.Context, m *Message) error {
+	delete(te.live, m.ID)
+	return nil
+}
+
+func TestProgress(t *testing.T) {
+	ctx := context.Background()
+	in := Message{ID: "in1", Channel: "ops", From: "bob"}
+
+	te := &testEditor{live: map[string]string{}}
+	p := NewProgress(ctx, newResponseWriter(te, in, "test"))
+	p.Printf("deploying %d%%", 10)
+	p.Printf("deploying %d%%", 100)
+	if exp := map[string]string{"m1": "ops:deploying 100%"}; !reflect.DeepEqual(te.live, exp) {
+		t.Fatalf("expected %v, got %v", exp, te.live)
+	}
+	if len(te.texts()) != 0 {
+		t.Fatalf("expected no plain sends, got %q", te.texts())
+	}
+	p.Clear()
+	if len(te.live) != 0 {
+		t.Fatalf("expected message to be deleted, got %v", te.live)
+	}
+
+	// Adapters that cannot edit get a new message for each update
+	ts := &testSender{}
+	p = NewProgress(ctx, newResponseWriter(ts, in, "test"))
+	p.Printf("deploying %d%%", 10)
+	p.Printf("deploying %d%%", 100)
+	if exp := []string{"deploying 10%", "deploying 100%"}; !reflect.DeepEqual(ts.texts(), exp) {
+		t.Fatalf("expected %q, got %q", exp, ts.texts())
+	}
+	for _, m := range ts.msgs {
+		if m.ID != "" || m.Channel != "ops" {
+			t.Fatalf("bad fallback message %#v", m)
+		}
+	}
+}
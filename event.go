@@ -0,0 +1,160 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"fmt"
+	"strings"
+
+	"context"
+)
+
+// EventType identifies the kind of a chat event
+type EventType string
+
+// The types of event that adapters may report
+const (
+	EventJoin           EventType = "join"            // A user joined the channel
+	EventLeave          EventType = "leave"           // A user left the channel
+	EventTopic          EventType = "topic"           // The channel topic was changed
+	EventChannelCreated EventType = "channel_created" // A new channel was created
+	EventPresence       EventType = "presence"        // A user's presence changed
+	EventEdited         EventType = "edited"          // A message was edited, the Text is the new text
+	EventDeleted        EventType = "deleted"         // A message was deleted
+)
+
+// Event describes something, other than a message, that happened in the
+// chat system. Adapters report events as a Message with the Event set,
+// the From, UserID and Channel of the message identify the user and
+// channel involved.
+type Event struct {
+	Type      EventType
+	Topic     string // The new topic, for EventTopic
+	Presence  string // The new presence of the user, e.g. "active" or "away", for EventPresence
+	MessageID string // The ID of the message, for EventEdited and EventDeleted
+}
+
+// EventHandler is a handler that is called when chat events occur.
+type EventHandler interface {
+	Handler
+	Event(ctx context.Context, w ResponseWriter, m *Message)
+}
+
+// EventFunc describes the calling convention for Event handlers. The event
+// is available as m.Event.
+type EventFunc func(ctx context.Context, w ResponseWriter, m *Message)
+
+type baseEventHandler struct {
+	Handler
+	types []EventType
+	ef    EventFunc
+}
+
+// NewEventHandler wraps f as an Event handler. If any types are given, f
+// is only called for events of those types.
+func NewEventHandler(name, desc string, types []EventType, f EventFunc) EventHandler {
+	return &baseEventHandler{
+		Handler: newBaseHandler(name, desc),
+		types:   types,
+		ef:      f,
+	}
+}
+
+func (beh *baseEventHandler) Event(ctx context.Context, w ResponseWriter, m *Message) {
+	if len(beh.types) > 0 {
+		found := false
+		for _, t := range beh.types {
+			if t == m.Event.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return
+		}
+	}
+	beh.ef(ctx, w, m)
+}
+
+// runEventHandler passes the event m to the handler
+func runEventHandler(ctx context.Context, h EventHandler, w ResponseWriter, m *Message) {
+	defer glogPanic()
+	h.Event(ctx, w, m)
+}
+
+// HandleEvent adds the provided handler to the DefaultMux
+func HandleEvent(h EventHandler) error {
+	return DefaultMux.HandleEvent(h)
+}
+
+// HandleEvent adds the provided handler to the mux. All event handlers
+// are called for every event.
+func (mx *Mux) HandleEvent(h EventHandler) error {
+	mx.Lock()
+	defer mx.Unlock()
+
+	mx.events = append(mx.events, h)
+	return nil
+}
+
+// event passes events to the event handlers
+func (mx *Mux) event(ctx context.Context, w ResponseWriter, m *Message) {
+	for _, h := range mx.events {
+		mc := *m
+		go runEventHandler(ctx, h, w, &mc)
+	}
+}
+
+// SetRerunOnEdit sets whether the named command on the DefaultMux is run
+// again when the message that invoked it is edited.
+func SetRerunOnEdit(name string, on bool) {
+	DefaultMux.SetRerunOnEdit(name, on)
+}
+
+// SetRerunOnEdit sets whether the named command is run again when the
+// message that invoked it is edited, letting users correct mistakes
+// without retyping the whole command. Commands are not re-run by default.
+func (mx *Mux) SetRerunOnEdit(name string, on bool) {
+	mx.Lock()
+	defer mx.Unlock()
+
+	mx.reruns[name] = on
+}
+
+// rerun runs the command in an edited message, if the command has opted
+// in to being re-run.
+func (mx *Mux) rerun(ctx context.Context, w ResponseWriter, m *Message) {
+	fs := strings.Fields(m.Text)
+	if !m.ToBot || len(fs) == 0 {
+		return
+	}
+	h, err := mx.cmds.Lookup(fs[0])
+	if err != nil {
+		return
+	}
+	if n, _ := h.Describe(); !mx.reruns[n] {
+		return
+	}
+
+	mc := *m
+	mc.Event = nil
+	w = mx.pager(ctx, w, &mc)
+	if err := mx.command(ctx, w, &mc); err != nil && err != ErrSkipHears {
+		fmt.Fprintf(w, "error, %s", err.Error())
+	}
+}
@@ -0,0 +1,70 @@
+package hugot
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestMux_Events(t *testing.T) {
+	mx := NewMux("test", "")
+	done := make(chan struct{})
+	mx.HandleEvent(NewEventHandler("greeter", "", []EventType{EventJoin, EventTopic}, func(ctx context.Context, w ResponseWriter, m *Message) {
+		switch m.Event.Type {
+		case EventJoin:
+			fmt.Fprintf(w, "welcome to %s, %s", m.Channel, m.From)
+		case EventTopic:
+			fmt.Fprintf(w, "topic is now %q", m.Event.Topic)
+		}
+		done <- struct{}{}
+	}))
+
+	ts := &testSender{}
+	for _, e := range []Event{
+		{Type: EventPresence, Presence: "away"},
+		{Type: EventJoin},
+		{Type: EventTopic, Topic: "deploys"},
+	} {
+		e := e
+		m := &Message{Channel: "ops", From: "bob", Event: &e}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+		if e.Type != EventPresence {
+			<-done
+		}
+	}
+
+	exp := []string{"welcome to ops, bob", `topic is now "deploys"`}
+	if got := ts.texts(); fmt.Sprint(got) != fmt.Sprint(exp) {
+		t.Errorf("expected %q, got %q", exp, got)
+	}
+}
+
+func TestMux_RerunOnEdit(t *testing.T) {
+	mx := NewMux("test", "")
+	mx.HandleCommand(NewCommandHandler("deploy", "", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		if err := m.Parse(); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "deploying %v", m.Args())
+		return nil
+	}, nil))
+
+	edit := func(txt string) []string {
+		ts := &testSender{}
+		m := &Message{ID: "1", Text: txt, ToBot: true, Event: &Event{Type: EventEdited, MessageID: "1"}}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+		return ts.texts()
+	}
+
+	if got := edit("deploy web"); len(got) != 0 {
+		t.Errorf("expected no rerun, got %q", got)
+	}
+
+	mx.SetRerunOnEdit("deploy", true)
+	if got := edit("deploy web"); fmt.Sprint(got) != "[deploying [web]]" {
+		t.Errorf("expected rerun, got %q", got)
+	}
+	if got := edit("help"); len(got) != 0 {
+		t.Errorf("expected no rerun of help, got %q", got)
+	}
+}
@@ -0,0 +1,401 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"context"
+
+	"github.com/golang/glog"
+)
+
+// ErrNoUploads is returned when uploading a file via an adapter that does
+// not support files.
+var ErrNoUploads = errors.New("adapter does not support file uploads")
+
+// ErrFileTooLarge is returned when serving a file larger than the Mux
+// allows.
+var ErrFileTooLarge = errors.New("file is too large to serve")
+
+// DefaultFileTimeout is how long files are served by the Mux, for
+// adapters that cannot upload files.
+var DefaultFileTimeout = time.Hour
+
+// DefaultMaxFileSize is the size, in bytes, of the largest file served by
+// the Mux.
+var DefaultMaxFileSize int64 = 10 << 20
+
+// DefaultMaxFileStore is the total size, in bytes, of the files held by
+// the Mux for serving. The oldest files are dropped to make room for new
+// ones.
+var DefaultMaxFileStore int64 = 100 << 20
+
+// maxServedFiles bounds the number of files held for serving
+const maxServedFiles = 1024
+
+// File is a file sent with, or attached to, a message. Adapters give
+// access to the content of files users upload via the Reader, which may
+// only download the file when first read.
+type File struct {
+	Name     string    // The file name, e.g. "report.csv"
+	MIMEType string    // The type of the content, derived from Name if empty
+	URL      string    // Where the file can be viewed, if known
+	Reader   io.Reader // The content of the file
+}
+
+// mimeType returns the type of f, guessing from the file name if needed
+func (f File) mimeType() string {
+	if f.MIMEType != "" {
+		return f.MIMEType
+	}
+	if t := mime.TypeByExtension(path.Ext(f.Name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// Uploader is implemented by adapters that can send files. The file is
+// sent to the channel, or user, of m, with the text of m as a comment.
+type Uploader interface {
+	Upload(ctx context.Context, m *Message, f File) error
+}
+
+// Upload sends the file f via the response writer w. If the adapter
+// cannot upload files, and w was passed to the handler by a Mux, the file
+// is served by the Mux and a link to it is sent instead.
+func Upload(ctx context.Context, w ResponseWriter, f File) error {
+	if u, ok := w.(Uploader); ok {
+		return u.Upload(ctx, &Message{}, f)
+	}
+	return ErrNoUploads
+}
+
+// Upload implements Uploader
+func (w *responseWriter) Upload(ctx context.Context, m *Message, f File) error {
+	u, ok := w.snd.(Uploader)
+	if !ok {
+		return ErrNoUploads
+	}
+	messagesTx.WithLabelValues(w.an, w.msg.Channel, w.msg.From).Inc()
+	return u.Upload(ctx, Format(w.snd, w.outbound(m)), f)
+}
+
+// sendFiles sends the text of m, and then uploads each of its files, if
+// the sender supports uploads. It returns false if the files were not
+// sent.
+func (w *responseWriter) sendFiles(ctx context.Context, m *Message) bool {
+	u, ok := w.snd.(Uploader)
+	if !ok || len(m.Files) == 0 {
+		return false
+	}
+
+	nm := *m
+	nm.Files = nil
+	if nm.Text != "" || len(nm.Attachments) > 0 {
+		w.Send(ctx, &nm)
+	}
+
+	nm.Text = ""
+	nm.Attachments = nil
+	for _, f := range m.Files {
+		if err := u.Upload(ctx, &nm, f); err != nil {
+			glog.Errorf("error uploading %s, %v", f.Name, err)
+		}
+	}
+	return true
+}
+
+type servedFile struct {
+	name     string
+	mimeType string
+	data     []byte
+	expires  time.Time
+}
+
+// fileStore holds files served by the Mux
+type fileStore struct {
+	sync.Mutex
+	timeout  time.Duration
+	maxSize  int64 // Largest file that may be stored
+	maxTotal int64 // Total size of all stored files
+	total    int64
+	files    map[string]servedFile
+	now      func() time.Time
+}
+
+func newFileStore() *fileStore {
+	return &fileStore{
+		timeout:  DefaultFileTimeout,
+		maxSize:  DefaultMaxFileSize,
+		maxTotal: DefaultMaxFileStore,
+		files:    map[string]servedFile{},
+		now:      time.Now,
+	}
+}
+
+// add stores the content of f, returning its ID
+func (fs *fileStore) add(f File) (string, error) {
+	if f.Reader == nil {
+		return "", fmt.Errorf("file %s has no content", f.Name)
+	}
+
+	fs.Lock()
+	max := fs.maxSize
+	fs.Unlock()
+
+	data, err := ioutil.ReadAll(io.LimitReader(f.Reader, max+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > max {
+		return "", ErrFileTooLarge
+	}
+
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(bs)
+
+	fs.Lock()
+	defer fs.Unlock()
+
+	now := fs.now()
+	for k, sf := range fs.files {
+		if now.After(sf.expires) {
+			fs.remove(k)
+		}
+	}
+	for len(fs.files) > 0 && (len(fs.files) >= maxServedFiles || fs.total+int64(len(data)) > fs.maxTotal) {
+		fs.remove(fs.oldest())
+	}
+	if fs.total+int64(len(data)) > fs.maxTotal {
+		return "", ErrFileTooLarge
+	}
+
+	fs.files[id] = servedFile{f.Name, f.mimeType(), data, now.Add(fs.timeout)}
+	fs.total += int64(len(data))
+
+	return id, nil
+}
+
+func (fs *fileStore) remove(id string) {
+	fs.total -= int64(len(fs.files[id].data))
+	delete(fs.files, id)
+}
+
+// oldest returns the ID of the file that expires first
+func (fs *fileStore) oldest() string {
+	var id string
+	var exp time.Time
+	for k, sf := range fs.files {
+		if id == "" || sf.expires.Before(exp) {
+			id, exp = k, sf.expires
+		}
+	}
+	return id
+}
+
+func (fs *fileStore) get(id string) (servedFile, bool) {
+	fs.Lock()
+	defer fs.Unlock()
+
+	sf, ok := fs.files[id]
+	if !ok || fs.now().After(sf.expires) {
+		return servedFile{}, false
+	}
+	return sf, true
+}
+
+// ServeHTTP serves stored files. Paths are of the form
+// /<mux name>/files/<id>/<file name>.
+func (fs *fileStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 3 {
+		http.NotFound(w, r)
+		return
+	}
+
+	sf, ok := fs.get(parts[2])
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", sf.mimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": sf.name}))
+	w.Write(sf.data)
+}
+
+// SetFileTimeout sets how long the DefaultMux serves files for
+func SetFileTimeout(d time.Duration) {
+	DefaultMux.SetFileTimeout(d)
+}
+
+// SetFileTimeout sets how long files are served for, for adapters that
+// cannot upload files.
+func (mx *Mux) SetFileTimeout(d time.Duration) {
+	mx.files.Lock()
+	defer mx.files.Unlock()
+
+	mx.files.timeout = d
+}
+
+// SetMaxFileSize sets the largest file, and the total size of all files,
+// served by the DefaultMux
+func SetMaxFileSize(size, total int64) {
+	DefaultMux.SetMaxFileSize(size, total)
+}
+
+// SetMaxFileSize sets the size, in bytes, of the largest file the Mux
+// serves, and the total size of all the files it holds. Serving larger
+// files fails with ErrFileTooLarge.
+func (mx *Mux) SetMaxFileSize(size, total int64) {
+	mx.files.Lock()
+	defer mx.files.Unlock()
+
+	mx.files.maxSize = size
+	mx.files.maxTotal = total
+}
+
+// ServeFile serves the file f from the DefaultMux
+func ServeFile(f File) (*url.URL, error) {
+	return DefaultMux.ServeFile(f)
+}
+
+// ServeFile makes the content of f available from the Mux's web handler,
+// for a while, and returns its URL.
+func (mx *Mux) ServeFile(f File) (*url.URL, error) {
+	return mx.serveFile(mx.URL(), f)
+}
+
+func (mx *Mux) serveFile(base *url.URL, f File) (*url.URL, error) {
+	id, err := mx.files.add(f)
+	if err != nil {
+		return nil, err
+	}
+
+	nu := *base
+	nu.Path = fmt.Sprintf("/%s/files/%s/%s", mx.name, id, path.Base("/"+f.Name))
+	return &nu, nil
+}
+
+// fileWriter serves files sent to adapters that cannot upload them, and
+// sends links to them instead.
+type fileWriter struct {
+	ResponseWriter
+	mx   *Mux
+	base *url.URL
+}
+
+// filer wraps w to serve files, if the adapter in ctx cannot upload them.
+func (mx *Mux) filer(ctx context.Context, w ResponseWriter) ResponseWriter {
+	a, ok := AdapterFromContext(ctx)
+	if !ok {
+		return w
+	}
+	if _, ok := a.(Uploader); ok {
+		return w
+	}
+	return &fileWriter{w, mx, mx.url()}
+}
+
+// Copy returns a copy of this writer, that also serves files
+func (w *fileWriter) Copy() ResponseWriter {
+	return &fileWriter{w.ResponseWriter.Copy(), w.mx, w.base}
+}
+
+// link serves f, and returns text linking to it.
+func (w *fileWriter) link(f File) string {
+	u, err := w.mx.serveFile(w.base, f)
+	if err != nil {
+		glog.Errorf("error serving %s, %v", f.Name, err)
+		return f.Name + ": unavailable"
+	}
+	return f.Name + ": " + u.String()
+}
+
+// Send implements Sender, files are replaced with links to them.
+func (w *fileWriter) Send(ctx context.Context, m *Message) {
+	if len(m.Files) == 0 {
+		w.ResponseWriter.Send(ctx, m)
+		return
+	}
+
+	nm := *m
+	nm.Files = nil
+	ls := []string{}
+	if m.Text != "" {
+		ls = append(ls, m.Text)
+	}
+	for _, f := range m.Files {
+		ls = append(ls, w.link(f))
+	}
+	nm.Text = strings.Join(ls, "\n")
+	w.ResponseWriter.Send(ctx, &nm)
+}
+
+// Upload implements Uploader, sending a link to the file.
+func (w *fileWriter) Upload(ctx context.Context, m *Message, f File) error {
+	_, err := fmt.Fprint(w.ResponseWriter, w.link(f))
+	return err
+}
+
+// lazyReader opens the underlying reader on the first read
+type lazyReader struct {
+	open func() (io.ReadCloser, error)
+	r    io.ReadCloser
+	err  error
+}
+
+// NewLazyReader returns a reader that calls open when first read. Adapters
+// can use this to give access to uploaded files without downloading them
+// until they are needed.
+func NewLazyReader(open func() (io.ReadCloser, error)) io.ReadCloser {
+	return &lazyReader{open: open}
+}
+
+func (l *lazyReader) Read(bs []byte) (int, error) {
+	if l.r == nil && l.err == nil {
+		l.r, l.err = l.open()
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	return l.r.Read(bs)
+}
+
+func (l *lazyReader) Close() error {
+	if l.r == nil {
+		return nil
+	}
+	return l.r.Close()
+}
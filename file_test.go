@@ -0,0 +1,107 @@
+package hugot
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testAdapter struct {
+	testSender
+}
+
+func (*testAdapter) Receive() <-chan *Message { return nil }
+
+type testUploadAdapter struct {
+	testAdapter
+	uploads []string
+}
+
+func (ta *testUploadAdapter) Upload(ctx context.Context, m *Message, f File) error {
+	bs, err := ioutil.ReadAll(f.Reader)
+	if err != nil {
+		return err
+	}
+	ta.Lock()
+	defer ta.Unlock()
+	ta.uploads = append(ta.uploads, fmt.Sprintf("%s %s %s", m.Channel, f.Name, bs))
+	return nil
+}
+
+func TestMux_Upload(t *testing.T) {
+	mx := NewMux("test", "")
+	mx.HandleCommand(NewCommandHandler("report", "", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		return Upload(ctx, w, File{Name: "report.csv", MIMEType: "text/csv", Reader: strings.NewReader("a,b\n1,2\n")})
+	}, nil))
+	mx.HandleCommand(NewCommandHandler("graph", "", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		w.Send(ctx, &Message{Channel: m.Channel, Text: "here you go", Files: []File{{Name: "graph.txt", Reader: strings.NewReader("/\\/")}}})
+		return nil
+	}, nil))
+
+	ua := &testUploadAdapter{}
+	for _, cmd := range []string{"report", "graph"} {
+		m := &Message{Channel: "ops", From: "bob", Text: cmd, ToBot: true}
+		mx.ProcessMessage(NewAdapterContext(context.Background(), ua), newResponseWriter(ua, *m, "test"), m)
+	}
+	if exp := "[ops report.csv a,b\n1,2\n ops graph.txt /\\/]"; fmt.Sprint(ua.uploads) != exp {
+		t.Errorf("expected uploads %q, got %q", exp, ua.uploads)
+	}
+	if got := ua.texts(); len(got) != 1 || got[0] != "here you go" {
+		t.Errorf("expected the message text to be sent, got %q", got)
+	}
+
+	ta := &testAdapter{}
+	m := &Message{Channel: "ops", From: "bob", Text: "report", ToBot: true}
+	mx.ProcessMessage(NewAdapterContext(context.Background(), ta), newResponseWriter(ta, *m, "test"), m)
+	got := ta.texts()
+	if len(got) != 1 || !strings.HasPrefix(got[0], "report.csv: /test/files/") {
+		t.Fatalf("expected a link to the file, got %q", got)
+	}
+
+	rec := httptest.NewRecorder()
+	mx.ServeHTTP(rec, httptest.NewRequest("GET", strings.TrimPrefix(got[0], "report.csv: "), nil))
+	if rec.Body.String() != "a,b\n1,2\n" || rec.Header().Get("Content-Type") != "text/csv" {
+		t.Errorf("unexpected file served, %q %q", rec.Header(), rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mx.ServeHTTP(rec, httptest.NewRequest("GET", "/test/files/nothere/report.csv", nil))
+	if rec.Code != 404 {
+		t.Errorf("expected not found, got %d", rec.Code)
+	}
+}
+
+func TestMux_ServeFileLimits(t *testing.T) {
+	mx := NewMux("test", "")
+	mx.SetMaxFileSize(4, 8)
+
+	if _, err := mx.ServeFile(File{Name: "big", Reader: strings.NewReader("12345")}); err != ErrFileTooLarge {
+		t.Fatalf("expected ErrFileTooLarge, got %v", err)
+	}
+
+	var ids []string
+	for _, c := range []string{"aaaa", "bbbb", "cccc"} {
+		u, err := mx.ServeFile(File{Name: c, Reader: strings.NewReader(c)})
+		if err != nil {
+			t.Fatalf("could not serve %s, %v", c, err)
+		}
+		ids = append(ids, strings.Split(u.Path, "/")[3])
+		mx.files.now = func() time.Time { return time.Now().Add(time.Duration(len(ids)) * time.Second) }
+	}
+
+	if _, ok := mx.files.get(ids[0]); ok {
+		t.Errorf("expected the oldest file to be dropped")
+	}
+	for _, id := range ids[1:] {
+		if _, ok := mx.files.get(id); !ok {
+			t.Errorf("expected file %s to be served", id)
+		}
+	}
+	if mx.files.total != 8 {
+		t.Errorf("expected 8 bytes stored, got %d", mx.files.total)
+	}
+}
@@ -99,6 +99,7 @@ type ResponseWriter interface {
 	SetChannel(c string) // Forces messages to a certain channel
 	SetTo(to string)     // Forces messages to a certain user
 	SetSender(a Sender)  // Forces messages to a different sender or adapter
+	SetThread(id string) // Sends messages to a thread, "" for the main channel
 
 	Copy() ResponseWriter // Returns a copy of this response writer
 }
@@ -129,7 +130,9 @@ func ResponseWriterFromContext(ctx context.Context) (ResponseWriter, bool) {
 // new message that is then sent to the ResoneWriter's current adapter
 func (w *responseWriter) Write(bs []byte) (int, error) {
 	nmsg := w.msg
+	nmsg.ID = ""
 	nmsg.Text = string(bs)
+	nmsg.Files = nil
 	w.Send(context.TODO(), &nmsg)
 	return len(bs), nil
 }
@@ -144,6 +147,11 @@ func (w *responseWriter) SetTo(s string) {
 	w.msg.To = s
 }
 
+// SetThread sets the thread for messages sent via this writer
+func (w *responseWriter) SetThread(id string) {
+	w.msg.ThreadID = id
+}
+
 // SetSender sets the target adapter for sender sent via this writer
 func (w *responseWriter) SetSender(s Sender) {
 	w.snd = s
@@ -151,13 +159,19 @@ func (w *responseWriter) SetSender(s Sender) {
 
 // Send implements the Sender interface
 func (w *responseWriter) Send(ctx context.Context, m *Message) {
+	if w.sendFiles(ctx, m) {
+		return
+	}
 	messagesTx.WithLabelValues(w.an, m.Channel, m.From).Inc()
-	w.snd.Send(ctx, m)
+	w.snd.Send(ctx, Format(w.snd, textOnly(w.snd, m)))
 }
 
-// Copy returns a copy of this response writer
+// Copy returns a copy of this response writer, initially sending to the
+// same channel, user and thread. Nothing else of the message being replied
+// to is kept.
 func (w *responseWriter) Copy() ResponseWriter {
-	return &responseWriter{w.snd, Message{}, w.an}
+	m := Message{Channel: w.msg.Channel, To: w.msg.To, ThreadID: w.msg.ThreadID}
+	return &responseWriter{w.snd, m, w.an}
 }
 
 // nullSender is a sender which discards anything sent to it, this is
@@ -280,6 +294,19 @@ func (bhh *baseHearsHandler) Heard(ctx context.Context, w ResponseWriter, m *Mes
 	bhh.hhf(ctx, w, m, submatches)
 }
 
+// NamedHeardFunc describes the calling convention for Hears handlers that
+// use the named capture groups of their regexp. groups maps the names of
+// the groups to the text they matched.
+type NamedHeardFunc func(ctx context.Context, w ResponseWriter, m *Message, groups map[string]string)
+
+// NewNamedHearsHandler wraps f as a Hears handler that responds to the regexp
+// provided. f is passed the named capture groups of the first match.
+func NewNamedHearsHandler(name, desc string, rgxp *regexp.Regexp, f NamedHeardFunc) HearsHandler {
+	return NewHearsHandler(name, desc, rgxp, func(ctx context.Context, w ResponseWriter, m *Message, submatches [][]string) {
+		f(ctx, w, m, NamedGroups(rgxp, submatches))
+	})
+}
+
 // CommandFunc describes the calling convention for CommandHandler
 type CommandFunc func(ctx context.Context, w ResponseWriter, m *Message) error
 
@@ -381,31 +408,42 @@ func (cs *CommandSet) NextCommand(ctx context.Context, w ResponseWriter, m *Mess
 		return fmt.Errorf("required sub-command missing: %s", strings.Join(cmds, ", "))
 	}
 
+	cmd, err := cs.Lookup(m.args[0])
+	if err != nil {
+		return err
+	}
+	return runCommandHandler(ctx, cmd, w, m)
+}
+
+// Lookup finds the command handler that would be used for the command
+// name. An exact match is preferred, otherwise name may be an unambiguous
+// prefix of a command name.
+func (cs *CommandSet) Lookup(name string) (CommandHandler, error) {
 	matches := []CommandHandler{}
 	matchesns := []string{}
 	ematches := []CommandHandler{}
-	for name, cmd := range *cs {
-		if strings.HasPrefix(name, m.args[0]) {
+	for n, cmd := range *cs {
+		if strings.HasPrefix(n, name) {
 			matches = append(matches, cmd)
-			matchesns = append(matchesns, name)
+			matchesns = append(matchesns, n)
 		}
-		if name == m.args[0] {
+		if n == name {
 			ematches = append(ematches, cmd)
 		}
 	}
 	if len(matches) == 0 && len(ematches) == 0 {
-		return ErrUnknownCommand
+		return nil, ErrUnknownCommand
 	}
 	if len(ematches) > 1 {
-		return fmt.Errorf("multiple exact matches for %s", m.args[0])
+		return nil, fmt.Errorf("multiple exact matches for %s", name)
 	}
 	if len(ematches) == 1 {
-		return runCommandHandler(ctx, ematches[0], w, m)
+		return ematches[0], nil
 	}
 	if len(matches) == 1 {
-		return runCommandHandler(ctx, matches[0], w, m)
+		return matches[0], nil
 	}
-	return fmt.Errorf("ambigious command, %s: %s", m.args[0], strings.Join(matchesns, ", "))
+	return nil, fmt.Errorf("ambigious command, %s: %s", name, strings.Join(matchesns, ", "))
 }
 
 type baseCommandHandler struct {
@@ -533,8 +571,10 @@ func Loop(ctx context.Context, h Handler, a Adapter, as ...Adapter) {
 	}
 
 	type smrw struct {
-		w ResponseWriter
-		m *Message
+		a  Adapter
+		an string
+		w  ResponseWriter
+		m  *Message
 	}
 	mrws := make(chan smrw)
 
@@ -545,7 +585,7 @@ func Loop(ctx context.Context, h Handler, a Adapter, as ...Adapter) {
 				select {
 				case m := <-a.Receive():
 					rw := newResponseWriter(a, *m, an)
-					mrws <- smrw{rw, m}
+					mrws <- smrw{a, an, rw, m}
 				case <-ctx.Done():
 					return
 				}
@@ -559,18 +599,35 @@ func Loop(ctx context.Context, h Handler, a Adapter, as ...Adapter) {
 			if glog.V(3) {
 				glog.Infof("Message: %#v", *mrw.m)
 			}
-			messagesRx.WithLabelValues(an, mrw.m.Channel, mrw.m.From).Inc()
+			messagesRx.WithLabelValues(mrw.an, mrw.m.Channel, mrw.m.From).Inc()
+
+			// Handlers are given the adapter the message arrived on
+			mctx := NewAdapterContext(ctx, mrw.a)
 
 			if rh, ok := h.(RawHandler); ok {
-				go runRawHandler(ctx, rh, mrw.w, mrw.m)
+				go runRawHandler(mctx, rh, mrw.w, mrw.m)
+			}
+
+			if mrw.m.Reaction != nil {
+				if rh, ok := h.(ReactionHandler); ok {
+					go runReactionHandler(mctx, rh, mrw.w, mrw.m)
+				}
+				continue
+			}
+
+			if mrw.m.Event != nil {
+				if eh, ok := h.(EventHandler); ok {
+					go runEventHandler(mctx, eh, mrw.w, mrw.m)
+				}
+				continue
 			}
 
 			if hh, ok := h.(HearsHandler); ok {
-				go runHearsHandler(ctx, hh, mrw.w, mrw.m)
+				go runHearsHandler(mctx, hh, mrw.w, mrw.m)
 			}
 
 			if ch, ok := h.(CommandHandler); ok {
-				go runCommandHandler(ctx, ch, mrw.w, mrw.m)
+				go runCommandHandler(mctx, ch, mrw.w, mrw.m)
 			}
 		case <-ctx.Done():
 			return
@@ -0,0 +1,234 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package channels provides a handler for managing the channels the bot
+// is in, on adapters that implement hugot.ChannelDirectory. e.g.
+//
+//	channels list
+//	channels info #ops
+//	channels members #ops
+//	channels join #ops
+//	channels leave
+//	channels topic #ops the build is broken
+//
+// Channels default to the one the command was sent in.
+package channels
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"context"
+
+	"github.com/tcolgate/hugot"
+)
+
+type channels struct {
+	admins []string
+}
+
+// New creates a channels handler. Only the admins may make the bot join
+// or leave channels, or set topics, if no admins are given nobody may.
+// Admins are given by the user ID reported by the adapter, e.g. U1234 on
+// Slack, or ident@host on IRC, as user names may be taken by anyone.
+func New(admins ...string) hugot.CommandHandler {
+	return &channels{admins: admins}
+}
+
+func (*channels) Describe() (string, string) {
+	return "channels", "list and manage channels. Sub commands list, info, members, join, leave and topic"
+}
+
+func (c *channels) Command(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message) error {
+	if err := m.Parse(); err != nil {
+		return err
+	}
+
+	cd, ok := hugot.ChannelDirectoryFromContext(ctx)
+	if !ok {
+		return hugot.ErrNoChannelDirectory
+	}
+
+	args := m.Args()
+	if len(args) == 0 {
+		return errors.New("usage: channels list|info|members|join|leave|topic [#channel]")
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		return list(ctx, w, cd)
+	case "info":
+		return info(ctx, w, m, args[1:])
+	case "members":
+		return members(ctx, w, cd, m, args[1:])
+	}
+
+	if !c.isAdmin(m) {
+		return errors.New("you are not allowed to do that")
+	}
+
+	switch args[0] {
+	case "join":
+		if len(args) != 2 {
+			return errors.New("usage: channels join #channel")
+		}
+		ci, err := hugot.LookupChannel(ctx, args[1])
+		switch {
+		case err == hugot.ErrUnknownChannel:
+			// Some adapters, such as IRC, only know of channels once they
+			// have joined them, and identify channels by name.
+			name := strings.TrimPrefix(args[1], "#")
+			ci = &hugot.ChannelInfo{ID: "#" + name, Name: name}
+		case err != nil:
+			return err
+		}
+		if err := cd.JoinChannel(ctx, ci.ID); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "joined %s", hugot.MentionChannel(ci.Name))
+		return nil
+	case "leave":
+		ci, err := channel(ctx, m, args[1:])
+		if err != nil {
+			return err
+		}
+		if !isChannel(ci, m.Channel) {
+			fmt.Fprintf(w, "leaving %s", hugot.MentionChannel(ci.Name))
+		}
+		return cd.LeaveChannel(ctx, ci.ID)
+	case "topic":
+		return topic(ctx, w, cd, m, args[1:])
+	}
+
+	return fmt.Errorf("unknown sub command %q", args[0])
+}
+
+func (c *channels) isAdmin(m *hugot.Message) bool {
+	if m.UserID == "" {
+		return false
+	}
+	for _, a := range c.admins {
+		if a == m.UserID {
+			return true
+		}
+	}
+	return false
+}
+
+// isChannel returns true if c, as given in Message.Channel, is the channel
+// ci. Some adapters, such as Slack, give the channel name rather than its
+// ID in messages.
+func isChannel(ci *hugot.ChannelInfo, c string) bool {
+	return ci.ID == c || ci.Name == strings.TrimPrefix(c, "#")
+}
+
+// channel looks up the channel named in args, or the channel of m if
+// none is given.
+func channel(ctx context.Context, m *hugot.Message, args []string) (*hugot.ChannelInfo, error) {
+	switch len(args) {
+	case 0:
+		return hugot.LookupChannel(ctx, m.Channel)
+	case 1:
+		return hugot.LookupChannel(ctx, args[0])
+	}
+	return nil, errors.New("expected a single channel")
+}
+
+func list(ctx context.Context, w hugot.ResponseWriter, cd hugot.ChannelDirectory) error {
+	cs, err := cd.Channels(ctx)
+	if err != nil {
+		return err
+	}
+	if len(cs) == 0 {
+		fmt.Fprint(w, "no channels found")
+		return nil
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Name < cs[j].Name })
+
+	buf := &bytes.Buffer{}
+	tw := new(tabwriter.Writer)
+	tw.Init(buf, 0, 8, 1, ' ', 0)
+	for _, ci := range cs {
+		flags := []string{}
+		if ci.Member {
+			flags = append(flags, "member")
+		}
+		if ci.Private {
+			flags = append(flags, "private")
+		}
+		fmt.Fprintf(tw, "#%s\t%s\t%s\n", ci.Name, strings.Join(flags, ","), ci.Topic)
+	}
+	tw.Flush()
+
+	fmt.Fprint(w, buf.String())
+	return nil
+}
+
+func info(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message, args []string) error {
+	ci, err := channel(ctx, m, args)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "#%s (%s)\ntopic: %s\nprivate: %v\nmember: %v", ci.Name, ci.ID, ci.Topic, ci.Private, ci.Member)
+	return nil
+}
+
+func members(ctx context.Context, w hugot.ResponseWriter, cd hugot.ChannelDirectory, m *hugot.Message, args []string) error {
+	ci, err := channel(ctx, m, args)
+	if err != nil {
+		return err
+	}
+	us, err := cd.ChannelMembers(ctx, ci.ID)
+	if err != nil {
+		return err
+	}
+
+	ns := []string{}
+	for _, u := range us {
+		n := u.Name
+		if n == "" {
+			n = u.ID
+		}
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+
+	fmt.Fprintf(w, "%d members of #%s: %s", len(ns), ci.Name, strings.Join(ns, ", "))
+	return nil
+}
+
+func topic(ctx context.Context, w hugot.ResponseWriter, cd hugot.ChannelDirectory, m *hugot.Message, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: channels topic [#channel] TOPIC")
+	}
+
+	cn := m.Channel
+	if strings.HasPrefix(args[0], "#") {
+		cn = args[0]
+		args = args[1:]
+	}
+	ci, err := hugot.LookupChannel(ctx, cn)
+	if err != nil {
+		return err
+	}
+
+	return cd.SetChannelTopic(ctx, ci.ID, strings.Join(args, " "))
+}
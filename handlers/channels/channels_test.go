@@ -0,0 +1,145 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package channels
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tcolgate/hugot"
+	"github.com/tcolgate/hugot/hugottest"
+)
+
+type testDirectory struct {
+	*hugottest.Adapter
+	chans  []hugot.ChannelInfo
+	joined []string
+	topics map[string]string
+}
+
+func (td *testDirectory) Channels(ctx context.Context) ([]hugot.ChannelInfo, error) {
+	return td.chans, nil
+}
+
+func (td *testDirectory) ChannelByID(ctx context.Context, id string) (*hugot.ChannelInfo, error) {
+	for _, c := range td.chans {
+		if c.ID == id {
+			return &c, nil
+		}
+	}
+	return nil, hugot.ErrUnknownChannel
+}
+
+func (td *testDirectory) ChannelByName(ctx context.Context, name string) (*hugot.ChannelInfo, error) {
+	for _, c := range td.chans {
+		if c.Name == name {
+			return &c, nil
+		}
+	}
+	return nil, hugot.ErrUnknownChannel
+}
+
+func (td *testDirectory) JoinChannel(ctx context.Context, id string) error {
+	td.joined = append(td.joined, id)
+	return nil
+}
+
+func (td *testDirectory) LeaveChannel(ctx context.Context, id string) error {
+	return nil
+}
+
+func (td *testDirectory) ChannelMembers(ctx context.Context, id string) ([]hugot.UserInfo, error) {
+	return []hugot.UserInfo{{ID: "U2", Name: "bob"}, {ID: "U1", Name: "alice"}}, nil
+}
+
+func (td *testDirectory) SetChannelTopic(ctx context.Context, id, topic string) error {
+	td.topics[id] = topic
+	return nil
+}
+
+func TestChannels(t *testing.T) {
+	td := &testDirectory{
+		Adapter: hugottest.NewAdapter(),
+		chans: []hugot.ChannelInfo{
+			{ID: "C1", Name: "general", Member: true},
+			{ID: "C2", Name: "ops", Topic: "all quiet"},
+		},
+		topics: map[string]string{},
+	}
+	ctx := hugot.NewAdapterContext(context.Background(), td)
+
+	mx := hugot.NewMux("test", "")
+	mx.HandleCommand(New("U1"))
+
+	noadmins := hugot.NewMux("test", "")
+	noadmins.HandleCommand(New())
+
+	tests := []struct {
+		mx   *hugot.Mux
+		from string
+		id   string
+		text string
+		exp  string
+	}{
+		{mx, "bob", "U2", "channels list", "#ops"},
+		{mx, "bob", "U2", "channels members", "2 members of #general: alice, bob"},
+		{mx, "bob", "U2", "channels join #ops", "not allowed"},
+		{mx, "U1", "", "channels join #ops", "not allowed"},
+		{noadmins, "alice", "U1", "channels join #ops", "not allowed"},
+		{mx, "alice", "U1", "channels join #ops", "joined #ops"},
+		{mx, "alice", "U1", "channels join #new", "joined #new"},
+		{mx, "alice", "U1", "channels topic #ops the build is broken", ""},
+	}
+
+	for _, tt := range tests {
+		td.ResponseRecorder.Messages = nil
+		w, _ := hugot.ResponseWriterFromContext(ctx)
+		m := &hugot.Message{Channel: "C1", From: tt.from, UserID: tt.id, ToBot: true, Text: tt.text}
+		tt.mx.ProcessMessage(ctx, w, m)
+
+		out := []string{}
+		for _, r := range td.ResponseRecorder.Messages {
+			out = append(out, r.Text)
+		}
+		got := strings.Join(out, "\n")
+		if !strings.Contains(got, tt.exp) {
+			t.Errorf("%q: expected %q in %q", tt.text, tt.exp, got)
+		}
+	}
+
+	// Slack gives channel names in messages, leaving the channel the
+	// command was sent in should not be announced.
+	for _, c := range []string{"C1", "general"} {
+		td.ResponseRecorder.Messages = nil
+		w, _ := hugot.ResponseWriterFromContext(ctx)
+		m := &hugot.Message{Channel: c, From: "alice", UserID: "U1", ToBot: true, Text: "channels leave"}
+		mx.ProcessMessage(ctx, w, m)
+		if len(td.ResponseRecorder.Messages) != 0 {
+			t.Errorf("leaving %s: unexpected output %q", c, td.ResponseRecorder.Messages[0].Text)
+		}
+	}
+
+	if exp := []string{"C2", "#new"}; !reflect.DeepEqual(td.joined, exp) {
+		t.Errorf("expected to join %v, joined %v", exp, td.joined)
+	}
+	if td.topics["C2"] != "the build is broken" {
+		t.Errorf("topic not set, got %q", td.topics["C2"])
+	}
+}
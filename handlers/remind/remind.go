@@ -0,0 +1,445 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package remind provides a handler for setting reminders. e.g.
+//
+//	remind me in 2h to check the build
+//	remind #ops at 17:00 tomorrow to rotate the logs
+//	remind @alice on friday that the release is due
+//	remind list
+//	remind cancel 3
+//	remind tz Europe/London
+package remind
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"context"
+
+	"github.com/golang/glog"
+	"github.com/tcolgate/hugot"
+)
+
+// Reminder is a message to be delivered at a later time
+type Reminder struct {
+	ID          int       `json:"id"`
+	Due         time.Time `json:"due"`
+	Text        string    `json:"text"`
+	Channel     string    `json:"channel"`
+	ChannelName string    `json:"channel_name,omitempty"` // Name of the channel, if it was looked up
+	To          string    `json:"to,omitempty"`           // The user to remind, empty to remind the whole channel
+	ToID        string    `json:"to_id,omitempty"`        // ID of the user to remind, if known
+	Adapter     string    `json:"adapter"`                // Name of the adapter the reminder was set on
+	AdapterID   string    `json:"adapter_id,omitempty"`   // The adapter instance, while this process runs
+
+	User    string    `json:"user"` // The user that set the reminder
+	UserID  string    `json:"user_id"`
+	Created time.Time `json:"created"`
+}
+
+var entriesKey = []byte("remind#entries")
+
+func tzKey(user string) []byte {
+	return []byte("remind#tz#" + user)
+}
+
+type reminder struct {
+	s hugot.Storer
+
+	sync.Mutex
+	adapters map[string]hugot.Adapter // Adapters we have seen messages from, by instance
+	byName   map[string]hugot.Adapter // The last adapter seen with each name
+	now      func() time.Time
+}
+
+// New creates a reminder handler, storing reminders and user time zones
+// in s. The handler should be added with Handle, so that it can see
+// incoming messages, and deliver reminders in the background.
+func New(s hugot.Storer) hugot.Handler {
+	return &reminder{
+		s:        s,
+		adapters: map[string]hugot.Adapter{},
+		byName:   map[string]hugot.Adapter{},
+		now:      time.Now,
+	}
+}
+
+func (*reminder) Describe() (string, string) {
+	return "remind", "set reminders, e.g. remind me in 2h to check the build. Sub commands list, cancel and tz manage reminders"
+}
+
+// ProcessMessage notes the adapters that messages arrive on, so that
+// reminders can be delivered via the adapter they were set on, even
+// after a restart.
+func (r *reminder) ProcessMessage(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message) error {
+	r.noteAdapter(ctx)
+	return nil
+}
+
+func (r *reminder) noteAdapter(ctx context.Context) {
+	if a, ok := hugot.AdapterFromContext(ctx); ok {
+		r.Lock()
+		r.adapters[adapterID(a)] = a
+		r.byName[hugot.AdapterName(ctx)] = a
+		r.Unlock()
+	}
+}
+
+// adapterID identifies a, distinguishing it from other adapters of the
+// same type. It is only meaningful within the running process.
+func adapterID(a hugot.Adapter) string {
+	return fmt.Sprintf("%T@%p", a, a)
+}
+
+func userKey(id, name string) string {
+	if id != "" {
+		return id
+	}
+	return name
+}
+
+// concerns checks if rem was set by, or is for, the sender of m
+func concerns(rem Reminder, m *hugot.Message) bool {
+	k := m.UserKey()
+	return userKey(rem.UserID, rem.User) == k || (rem.To != "" && userKey(rem.ToID, rem.To) == k)
+}
+
+func (r *reminder) load() ([]Reminder, error) {
+	bs, ok, err := r.s.Get(entriesKey)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var rs []Reminder
+	err = json.Unmarshal(bs, &rs)
+	return rs, err
+}
+
+func (r *reminder) save(rs []Reminder) error {
+	bs, err := json.Marshal(rs)
+	if err != nil {
+		return err
+	}
+	return r.s.Set(entriesKey, bs)
+}
+
+// location returns the time zone configured by the sender of m
+func (r *reminder) location(m *hugot.Message) *time.Location {
+	bs, ok, err := r.s.Get(tzKey(m.UserKey()))
+	if err != nil || !ok {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(string(bs))
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+func (r *reminder) Command(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message) error {
+	if err := m.Parse(); err != nil {
+		return err
+	}
+
+	args := m.Args()
+	if len(args) == 0 {
+		return errors.New("usage: remind [me|#channel|@user] WHEN WHAT")
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		return r.list(w, m)
+	case "cancel", "rm":
+		return r.cancel(w, m, args[1:])
+	case "tz":
+		return r.timezone(w, m, args[1:])
+	}
+
+	rem := Reminder{
+		Channel: m.Channel,
+		User:    m.From,
+		UserID:  m.UserID,
+		Created: r.now(),
+	}
+	if a, ok := hugot.AdapterFromContext(ctx); ok {
+		r.noteAdapter(ctx)
+		rem.Adapter = hugot.AdapterName(ctx)
+		rem.AdapterID = adapterID(a)
+	}
+
+	who := "you"
+	switch t := args[0]; {
+	case t == "me":
+		rem.To = m.From
+		rem.ToID = m.UserID
+	case strings.HasPrefix(t, "#"):
+		rem.Channel = strings.TrimPrefix(t, "#")
+		switch c, err := hugot.LookupChannel(ctx, t); err {
+		case nil:
+			rem.Channel, rem.ChannelName = c.ID, c.Name
+		case hugot.ErrNoChannelDirectory:
+		default:
+			return fmt.Errorf("unknown channel %s", t)
+		}
+		who = t
+	default:
+		rem.To = strings.TrimPrefix(t, "@")
+		if u, err := hugot.LookupUser(ctx, rem.To); err == nil {
+			rem.ToID = u.ID
+		}
+		who = rem.To
+	}
+
+	loc := r.location(m)
+	due, what, err := parseReminder(args[1:], r.now().In(loc))
+	if err != nil {
+		return err
+	}
+	rem.Due = due
+	rem.Text = what
+
+	r.Lock()
+	defer r.Unlock()
+
+	rs, err := r.load()
+	if err != nil {
+		return err
+	}
+	for _, o := range rs {
+		if o.ID >= rem.ID {
+			rem.ID = o.ID + 1
+		}
+	}
+	if err := r.save(append(rs, rem)); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "ok, I'll remind %s at %s (reminder %d)", who, due.Format("Mon Jan 2 15:04 MST"), rem.ID)
+	return nil
+}
+
+// parseReminder splits the words of a reminder into the time it is due,
+// and the text of the reminder. The time may come before or after the
+// text, e.g. "in 2h to check the build", or "to check the build in 2h".
+func parseReminder(ws []string, now time.Time) (time.Time, string, error) {
+	due, n, err := parseWhen(ws, now)
+	if err == nil {
+		what, err := reminderText(ws[n:])
+		return due, what, err
+	}
+	if err != errNoTime {
+		return time.Time{}, "", err
+	}
+
+	for i := 1; i < len(ws); i++ {
+		if due, n, werr := parseWhen(ws[i:], now); werr == nil && i+n == len(ws) {
+			what, err := reminderText(ws[:i])
+			return due, what, err
+		}
+	}
+
+	return time.Time{}, "", errors.New("I don't know when to remind you, try something like \"in 2h\" or \"at 17:00 tomorrow\"")
+}
+
+func reminderText(ws []string) (string, error) {
+	if len(ws) > 0 {
+		switch strings.ToLower(ws[0]) {
+		case "to", "that", "about":
+			ws = ws[1:]
+		}
+	}
+	if len(ws) == 0 {
+		return "", errors.New("what should I remind you about?")
+	}
+	return strings.Join(ws, " "), nil
+}
+
+func (r *reminder) list(w hugot.ResponseWriter, m *hugot.Message) error {
+	r.Lock()
+	defer r.Unlock()
+
+	rs, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	loc := r.location(m)
+	buf := &bytes.Buffer{}
+	tw := new(tabwriter.Writer)
+	tw.Init(buf, 0, 8, 1, ' ', 0)
+	found := false
+	for _, rem := range rs {
+		if !concerns(rem, m) {
+			continue
+		}
+		to := rem.To
+		switch {
+		case to != "":
+		case rem.ChannelName != "":
+			to = "#" + rem.ChannelName
+		default:
+			to = "#" + rem.Channel
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", rem.ID, rem.Due.In(loc).Format("Mon Jan 2 15:04 MST"), to, rem.Text)
+		found = true
+	}
+	tw.Flush()
+
+	if !found {
+		fmt.Fprint(w, "you have no reminders")
+		return nil
+	}
+	fmt.Fprint(w, buf.String())
+	return nil
+}
+
+func (r *reminder) cancel(w hugot.ResponseWriter, m *hugot.Message, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: remind cancel ID")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("bad reminder id %q", args[0])
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	rs, err := r.load()
+	if err != nil {
+		return err
+	}
+	for i, rem := range rs {
+		if rem.ID != id {
+			continue
+		}
+		if !concerns(rem, m) {
+			return fmt.Errorf("reminder %d is not yours to cancel", id)
+		}
+		if err := r.save(append(rs[:i], rs[i+1:]...)); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "cancelled reminder %d", id)
+		return nil
+	}
+
+	return fmt.Errorf("no reminder %d", id)
+}
+
+func (r *reminder) timezone(w hugot.ResponseWriter, m *hugot.Message, args []string) error {
+	switch len(args) {
+	case 0:
+		fmt.Fprintf(w, "your time zone is %s", r.location(m))
+		return nil
+	case 1:
+	default:
+		return errors.New("usage: remind tz [ZONE]")
+	}
+
+	loc, err := time.LoadLocation(args[0])
+	if err != nil {
+		return fmt.Errorf("unknown time zone %q", args[0])
+	}
+	if err := r.s.Set(tzKey(m.UserKey()), []byte(loc.String())); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "your time zone is now %s", loc)
+	return nil
+}
+
+// StartBackground delivers reminders as they fall due. Reminders set on
+// an adapter other than the one in ctx are held until a message arrives
+// from that adapter.
+func (r *reminder) StartBackground(ctx context.Context, w hugot.ResponseWriter) {
+	r.noteAdapter(ctx)
+
+	t := time.NewTicker(5 * time.Second)
+	defer t.Stop()
+
+	for {
+		r.deliverDue(ctx, w)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *reminder) deliverDue(ctx context.Context, w hugot.ResponseWriter) {
+	r.Lock()
+	defer r.Unlock()
+
+	rs, err := r.load()
+	if err != nil {
+		glog.Errorf("could not load reminders, %v", err)
+		return
+	}
+
+	now := r.now()
+	var keep []Reminder
+	for _, rem := range rs {
+		if rem.Due.After(now) || !r.deliver(ctx, w, rem) {
+			keep = append(keep, rem)
+		}
+	}
+
+	if len(keep) != len(rs) {
+		if err := r.save(keep); err != nil {
+			glog.Errorf("could not save reminders, %v", err)
+		}
+	}
+}
+
+// deliver sends the reminder via the adapter it was set on, or the
+// background ResponseWriter if it was set without one. It returns false
+// if the adapter has not been seen yet, and the reminder should be kept.
+func (r *reminder) deliver(ctx context.Context, bgw hugot.ResponseWriter, rem Reminder) bool {
+	w := bgw.Copy()
+	if rem.Adapter != "" {
+		a, ok := r.adapters[rem.AdapterID]
+		if !ok {
+			// The reminder was set before a restart
+			a, ok = r.byName[rem.Adapter]
+		}
+		if !ok {
+			glog.V(2).Infof("holding reminder %d until adapter %s is seen", rem.ID, rem.Adapter)
+			return false
+		}
+		w, _ = hugot.ResponseWriterFromContext(hugot.NewAdapterContext(ctx, a))
+	}
+
+	w.SetChannel(rem.Channel)
+	if rem.To != "" {
+		w.SetTo(rem.To)
+	}
+
+	msg := "reminder: " + rem.Text
+	if rem.To != rem.User {
+		msg = fmt.Sprintf("reminder from %s: %s", rem.User, rem.Text)
+	}
+	fmt.Fprint(w, msg)
+	return true
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package remind
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tcolgate/hugot"
+	"github.com/tcolgate/hugot/hugottest"
+	"github.com/tcolgate/hugot/storers/memory"
+)
+
+type testDirectory struct {
+	*hugottest.Adapter
+	users []hugot.UserInfo
+	chans []hugot.ChannelInfo
+}
+
+func (td *testDirectory) UserByID(ctx context.Context, id string) (*hugot.UserInfo, error) {
+	for _, u := range td.users {
+		if u.ID == id {
+			return &u, nil
+		}
+	}
+	return nil, hugot.ErrUnknownUser
+}
+
+func (td *testDirectory) UserByName(ctx context.Context, name string) (*hugot.UserInfo, error) {
+	for _, u := range td.users {
+		if u.Name == name {
+			return &u, nil
+		}
+	}
+	return nil, hugot.ErrUnknownUser
+}
+
+func (td *testDirectory) Channels(ctx context.Context) ([]hugot.ChannelInfo, error) {
+	return td.chans, nil
+}
+
+func (td *testDirectory) ChannelByID(ctx context.Context, id string) (*hugot.ChannelInfo, error) {
+	for _, c := range td.chans {
+		if c.ID == id {
+			return &c, nil
+		}
+	}
+	return nil, hugot.ErrUnknownChannel
+}
+
+func (td *testDirectory) ChannelByName(ctx context.Context, name string) (*hugot.ChannelInfo, error) {
+	for _, c := range td.chans {
+		if c.Name == name {
+			return &c, nil
+		}
+	}
+	return nil, hugot.ErrUnknownChannel
+}
+
+func (td *testDirectory) JoinChannel(ctx context.Context, id string) error        { return nil }
+func (td *testDirectory) LeaveChannel(ctx context.Context, id string) error       { return nil }
+func (td *testDirectory) SetChannelTopic(ctx context.Context, id, t string) error { return nil }
+func (td *testDirectory) ChannelMembers(ctx context.Context, id string) ([]hugot.UserInfo, error) {
+	return td.users, nil
+}
+
+func send(ctx context.Context, mx *hugot.Mux, a *hugottest.Adapter, from, id, txt string) string {
+	a.ResponseRecorder.Messages = nil
+	w, _ := hugot.ResponseWriterFromContext(ctx)
+	m := &hugot.Message{Channel: "ops", From: from, UserID: id, ToBot: true, Text: txt}
+	mx.ProcessMessage(ctx, w, m)
+
+	var out []string
+	for _, r := range a.ResponseRecorder.Messages {
+		out = append(out, r.Text)
+	}
+	return strings.Join(out, "\n")
+}
+
+func TestReminder(t *testing.T) {
+	now := time.Date(2016, 12, 23, 8, 0, 0, 0, time.UTC)
+	td := &testDirectory{
+		Adapter: hugottest.NewAdapter(),
+		users:   []hugot.UserInfo{{ID: "U1", Name: "bob"}, {ID: "U2", Name: "alice"}, {ID: "U3", Name: "carol"}},
+		chans:   []hugot.ChannelInfo{{ID: "C2", Name: "dev"}},
+	}
+	a := td.Adapter
+	ctx := hugot.NewAdapterContext(context.Background(), td)
+
+	r := New(memory.New()).(*reminder)
+	r.now = func() time.Time { return now }
+	mx := hugot.NewMux("test", "")
+	mx.Handle(r)
+
+	tests := []struct {
+		from, id, txt string
+		exp           string
+	}{
+		{"bob", "U1", "remind tz Mars/Olympus", "unknown time zone"},
+		{"bob", "U1", "remind tz UTC", "your time zone is now UTC"},
+		{"bob", "U1", "remind tz", "your time zone is UTC"},
+		{"bob", "U1", "remind me in 2h to check the build", "remind you at Fri Dec 23 10:00 UTC (reminder 0)"},
+		{"bob", "U1", "remind #dev that the release is due in 1h", "remind #dev at Fri Dec 23 09:00 UTC (reminder 1)"},
+		{"bob", "U1", "remind @alice in 3h to review", "remind alice at Fri Dec 23 11:00 UTC (reminder 2)"},
+		{"bob", "U1", "remind me in 2h", "what should I remind you about"},
+		{"bob", "U1", "remind #nosuch in 1h to panic", "unknown channel #nosuch"},
+		{"carol", "U3", "remind list", "you have no reminders"},
+		{"carol", "U3", "remind cancel 1", "not yours to cancel"},
+		{"bob", "U7", "remind cancel 1", "not yours to cancel"},
+		{"alice", "U2", "remind list", "review"},
+		{"bob", "U1", "remind list", "1 Fri Dec 23 09:00 UTC #dev  the release is due"},
+		{"bob", "U1", "remind cancel 2", "cancelled reminder 2"},
+		{"bob", "U1", "remind cancel 2", "no reminder 2"},
+	}
+	for _, tt := range tests {
+		if got := send(ctx, mx, a, tt.from, tt.id, tt.txt); !strings.Contains(got, tt.exp) {
+			t.Errorf("%q: expected %q in %q", tt.txt, tt.exp, got)
+		}
+	}
+
+	// The adapter is noted as StartBackground would
+	r.noteAdapter(ctx)
+	w, _ := hugot.ResponseWriterFromContext(ctx)
+	deliveries := []struct {
+		at                time.Duration
+		channel, to, text string
+	}{
+		{1 * time.Hour, "C2", "", "reminder from bob: the release is due"},
+		{2 * time.Hour, "ops", "bob", "reminder: check the build"},
+	}
+	for _, d := range deliveries {
+		a.ResponseRecorder.Messages = nil
+		now = time.Date(2016, 12, 23, 8, 0, 0, 0, time.UTC).Add(d.at)
+		r.deliverDue(ctx, w)
+
+		ms := a.ResponseRecorder.Messages
+		if len(ms) != 1 {
+			t.Fatalf("expected 1 reminder at +%v, got %d", d.at, len(ms))
+		}
+		if ms[0].Channel != d.channel || ms[0].To != d.to || ms[0].Text != d.text {
+			t.Errorf("expected %q to %q in %q, got %#v", d.text, d.to, d.channel, ms[0])
+		}
+	}
+
+	if got := send(ctx, mx, a, "bob", "U1", "remind list"); got != "you have no reminders" {
+		t.Errorf("expected delivered reminders to be removed, got %q", got)
+	}
+}
+
+func TestReminder_Restart(t *testing.T) {
+	now := time.Date(2016, 12, 23, 8, 0, 0, 0, time.UTC)
+	store := memory.New()
+	a := hugottest.NewAdapter()
+	ctx := hugot.NewAdapterContext(context.Background(), a)
+
+	r := New(store).(*reminder)
+	r.now = func() time.Time { return now }
+	mx := hugot.NewMux("test", "")
+	mx.Handle(r)
+	send(ctx, mx, a, "bob", "U1", "remind me in 1h to check the build")
+
+	// After a restart, the reminder should be held until its adapter is
+	// seen, rather than sent via the background writer.
+	now = now.Add(2 * time.Hour)
+	r = New(store).(*reminder)
+	r.now = func() time.Time { return now }
+
+	a.ResponseRecorder.Messages = nil
+	bg := hugottest.NewAdapter()
+	bgw, _ := hugot.ResponseWriterFromContext(hugot.NewAdapterContext(context.Background(), bg))
+	r.deliverDue(context.Background(), bgw)
+	if len(bg.ResponseRecorder.Messages) != 0 || len(a.ResponseRecorder.Messages) != 0 {
+		t.Fatalf("reminder delivered before its adapter was seen")
+	}
+
+	w, _ := hugot.ResponseWriterFromContext(ctx)
+	r.ProcessMessage(ctx, w, &hugot.Message{Channel: "ops", From: "alice", Text: "hello"})
+	r.deliverDue(context.Background(), bgw)
+	if ms := a.ResponseRecorder.Messages; len(ms) != 1 || ms[0].Text != "reminder: check the build" {
+		t.Fatalf("expected reminder via the original adapter, got %#v", ms)
+	}
+	if len(bg.ResponseRecorder.Messages) != 0 {
+		t.Fatalf("reminder sent via the background writer")
+	}
+}
+
+func TestReminder_Adapters(t *testing.T) {
+	now := time.Date(2016, 12, 23, 8, 0, 0, 0, time.UTC)
+	a1, a2 := hugottest.NewAdapter(), hugottest.NewAdapter()
+	ctx1 := hugot.NewAdapterContext(context.Background(), a1)
+	ctx2 := hugot.NewAdapterContext(context.Background(), a2)
+
+	r := New(memory.New()).(*reminder)
+	r.now = func() time.Time { return now }
+	mx := hugot.NewMux("test", "")
+	mx.Handle(r)
+
+	r.noteAdapter(ctx1)
+	send(ctx2, mx, a2, "bob", "U1", "remind me in 1h to check the build")
+
+	// Adapters of the same type are kept apart
+	now = now.Add(2 * time.Hour)
+	a1.ResponseRecorder.Messages = nil
+	a2.ResponseRecorder.Messages = nil
+	w, _ := hugot.ResponseWriterFromContext(ctx1)
+	r.deliverDue(ctx1, w)
+	if len(a1.ResponseRecorder.Messages) != 0 {
+		t.Fatalf("reminder delivered via the wrong adapter")
+	}
+	if ms := a2.ResponseRecorder.Messages; len(ms) != 1 || ms[0].Text != "reminder: check the build" {
+		t.Fatalf("expected reminder via the original adapter, got %#v", ms)
+	}
+}
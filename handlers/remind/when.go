@@ -0,0 +1,285 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package remind
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errNoTime = errors.New("no time given")
+
+// defaultHour is the time of day used when only a day is given
+const defaultHour = 9
+
+var units = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// parseWhen parses a time from the start of ws, relative to now, returning
+// the time and the number of words used. It understands phrases such as
+//
+//	in 2h, in 1 hour 30 minutes, in a day
+//	at 17:00, at 5pm tomorrow, at noon on friday
+//	tomorrow, tomorrow at 10am, on monday, on 2016-12-25 at 09:30
+func parseWhen(ws []string, now time.Time) (time.Time, int, error) {
+	if len(ws) == 0 {
+		return time.Time{}, 0, errNoTime
+	}
+
+	switch strings.ToLower(ws[0]) {
+	case "in":
+		d, n, err := parseDuration(ws[1:])
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		return now.Add(d), n + 1, nil
+	case "at":
+		h, m, n, err := parseClock(ws[1:])
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		n++
+		day, dn, err := parseDay(ws[n:], now)
+		switch err {
+		case nil:
+			t := atClock(day, h, m)
+			if !t.After(now) {
+				return time.Time{}, 0, fmt.Errorf("%s is in the past", t.Format("Mon Jan 2 15:04"))
+			}
+			return t, n + dn, nil
+		case errNoTime:
+			t := atClock(now, h, m)
+			if !t.After(now) {
+				t = t.AddDate(0, 0, 1)
+			}
+			return t, n, nil
+		default:
+			return time.Time{}, 0, err
+		}
+	}
+
+	day, n, err := parseDay(ws, now)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	h, m := defaultHour, 0
+	if n < len(ws) && strings.ToLower(ws[n]) == "at" {
+		var cn int
+		if h, m, cn, err = parseClock(ws[n+1:]); err != nil {
+			return time.Time{}, 0, err
+		}
+		n += cn + 1
+	}
+
+	t := atClock(day, h, m)
+	if !t.After(now) {
+		return time.Time{}, 0, fmt.Errorf("%s is in the past", t.Format("Mon Jan 2 15:04"))
+	}
+	return t, n, nil
+}
+
+func atClock(day time.Time, h, m int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, day.Location())
+}
+
+// parseDuration parses durations such as "2h", "1h30m", "2 days",
+// "an hour", or "1 hour and 30 minutes".
+func parseDuration(ws []string) (time.Duration, int, error) {
+	var total time.Duration
+	n := 0
+	for n < len(ws) {
+		w := strings.ToLower(ws[n])
+		if n > 0 && w == "and" {
+			n++
+			continue
+		}
+
+		if d, ok := parseCompactDuration(w); ok {
+			total += d
+			n++
+			continue
+		}
+
+		var v int
+		switch w {
+		case "a", "an":
+			v = 1
+		default:
+			v, _ = strconv.Atoi(w)
+		}
+		if v <= 0 || n+1 >= len(ws) {
+			break
+		}
+		u, ok := units[strings.ToLower(ws[n+1])]
+		if !ok {
+			break
+		}
+		total += time.Duration(v) * u
+		n += 2
+	}
+
+	// Don't consume a trailing "and"
+	for n > 0 && strings.ToLower(ws[n-1]) == "and" {
+		n--
+	}
+	if total <= 0 {
+		return 0, 0, errors.New("could not understand how long to wait")
+	}
+	return total, n, nil
+}
+
+// parseCompactDuration parses durations like 90m, 2d or 1h30m
+func parseCompactDuration(w string) (time.Duration, bool) {
+	var total time.Duration
+	for w != "" {
+		i := 0
+		for i < len(w) && w[i] >= '0' && w[i] <= '9' {
+			i++
+		}
+		j := i
+		for j < len(w) && (w[j] < '0' || w[j] > '9') {
+			j++
+		}
+		if i == 0 || j == i {
+			return 0, false
+		}
+		v, _ := strconv.Atoi(w[:i])
+		u, ok := units[w[i:j]]
+		if !ok {
+			return 0, false
+		}
+		total += time.Duration(v) * u
+		w = w[j:]
+	}
+	return total, total > 0
+}
+
+// parseClock parses a time of day, such as 17:00, 5pm, 5:30 pm, noon or
+// midnight.
+func parseClock(ws []string) (int, int, int, error) {
+	if len(ws) == 0 {
+		return 0, 0, 0, errors.New("no time of day given")
+	}
+
+	w := strings.ToLower(ws[0])
+	switch w {
+	case "noon", "midday":
+		return 12, 0, 1, nil
+	case "midnight":
+		return 0, 0, 1, nil
+	}
+
+	n := 1
+	suffix := ""
+	for _, s := range []string{"am", "pm"} {
+		if strings.HasSuffix(w, s) {
+			suffix, w = s, strings.TrimSuffix(w, s)
+		}
+	}
+	if suffix == "" && len(ws) > 1 {
+		if s := strings.ToLower(ws[1]); s == "am" || s == "pm" {
+			suffix = s
+			n++
+		}
+	}
+
+	hs, ms := w, "0"
+	if i := strings.Index(w, ":"); i != -1 {
+		hs, ms = w[:i], w[i+1:]
+	}
+	h, err := strconv.Atoi(hs)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("could not understand time %q", ws[0])
+	}
+	m, err := strconv.Atoi(ms)
+	if err != nil || m < 0 || m > 59 {
+		return 0, 0, 0, fmt.Errorf("could not understand time %q", ws[0])
+	}
+
+	switch suffix {
+	case "am", "pm":
+		if h < 1 || h > 12 {
+			return 0, 0, 0, fmt.Errorf("bad hour in %q", ws[0])
+		}
+		h = h % 12
+		if suffix == "pm" {
+			h += 12
+		}
+	default:
+		if h < 0 || h > 23 {
+			return 0, 0, 0, fmt.Errorf("bad hour in %q", ws[0])
+		}
+	}
+
+	return h, m, n, nil
+}
+
+// parseDay parses a day, such as today, tomorrow, friday, on monday or
+// on 2016-12-25. Weekdays refer to the next such day after today.
+func parseDay(ws []string, now time.Time) (time.Time, int, error) {
+	n := 0
+	if len(ws) > 0 && strings.ToLower(ws[0]) == "on" {
+		n++
+	}
+	if n >= len(ws) {
+		return time.Time{}, 0, errNoTime
+	}
+
+	w := strings.ToLower(ws[n])
+	switch w {
+	case "today":
+		return now, n + 1, nil
+	case "tomorrow":
+		return now.AddDate(0, 0, 1), n + 1, nil
+	}
+
+	if wd, ok := weekdays[w]; ok {
+		days := (int(wd) - int(now.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return now.AddDate(0, 0, days), n + 1, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", w, now.Location()); err == nil {
+		return t, n + 1, nil
+	}
+
+	if n > 0 {
+		return time.Time{}, 0, fmt.Errorf("could not understand day %q", ws[n])
+	}
+	return time.Time{}, 0, errNoTime
+}
@@ -0,0 +1,43 @@
+package remind
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReminder(t *testing.T) {
+	now := time.Date(2016, 12, 23, 10, 30, 0, 0, time.UTC) // A Friday
+	tests := []struct {
+		in   string
+		due  time.Time
+		what string
+	}{
+		{"in 2h to check the build", now.Add(2 * time.Hour), "check the build"},
+		{"in 1 hour and 30 minutes to stretch", now.Add(90 * time.Minute), "stretch"},
+		{"in an hour about lunch", now.Add(time.Hour), "lunch"},
+		{"at 17:00 tomorrow to rotate the logs", time.Date(2016, 12, 24, 17, 0, 0, 0, time.UTC), "rotate the logs"},
+		{"at 9am go home", time.Date(2016, 12, 24, 9, 0, 0, 0, time.UTC), "go home"},
+		{"at 5:30 pm on monday to deploy", time.Date(2016, 12, 26, 17, 30, 0, 0, time.UTC), "deploy"},
+		{"tomorrow that it is christmas eve", time.Date(2016, 12, 24, 9, 0, 0, 0, time.UTC), "it is christmas eve"},
+		{"on friday at noon to eat", time.Date(2016, 12, 30, 12, 0, 0, 0, time.UTC), "eat"},
+		{"to check the build in 90m", now.Add(90 * time.Minute), "check the build"},
+	}
+
+	for _, tt := range tests {
+		due, what, err := parseReminder(strings.Fields(tt.in), now)
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if !due.Equal(tt.due) || what != tt.what {
+			t.Errorf("%q: expected %v %q, got %v %q", tt.in, tt.due, tt.what, due, what)
+		}
+	}
+
+	for _, bad := range []string{"to do something", "in 2h", "at 25:00 to sleep", "today at 9am to wake"} {
+		if _, _, err := parseReminder(strings.Fields(bad), now); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCron_Next(t *testing.T) {
+	start := time.Date(2016, 12, 23, 10, 30, 0, 0, time.UTC) // A Friday
+	tests := []struct {
+		spec string
+		exp  time.Time
+	}{
+		{"* * * * *", time.Date(2016, 12, 23, 10, 31, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2016, 12, 26, 9, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2016, 12, 23, 10, 45, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 10 * * sun,7", time.Date(2016, 12, 25, 10, 30, 0, 0, time.UTC)},
+		{"@daily", time.Date(2016, 12, 24, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.spec, err)
+		}
+		if got := c.Next(start); !got.Equal(tt.exp) {
+			t.Errorf("%q: expected %v, got %v", tt.spec, tt.exp, got)
+		}
+	}
+
+	for _, bad := range []string{"* * * *", "60 * * * *", "5-1 * * * *", "*/0 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
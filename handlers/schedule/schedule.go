@@ -0,0 +1,462 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package schedule provides a handler that runs other commands of a Mux on
+// a cron schedule, or at a specific time. e.g.
+//
+//	schedule "0 9 * * 1-5" standup
+//	schedule -at "2016-12-25 09:00" say merry christmas
+//	schedule list
+//	schedule rm 3
+package schedule
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"context"
+
+	"github.com/golang/glog"
+	"github.com/tcolgate/hugot"
+)
+
+// Entry is a scheduled command
+type Entry struct {
+	ID       int       `json:"id"`
+	Spec     string    `json:"spec,omitempty"` // Cron expression for repeating schedules
+	At       time.Time `json:"at,omitempty"`   // Time of a one off schedule
+	Location string    `json:"location"`       // Time zone for the cron expression
+	Command  string    `json:"command"`
+
+	Channel string    `json:"channel"`
+	User    string    `json:"user"`
+	UserID  string    `json:"user_id"`
+	Private bool      `json:"private"`
+	Created time.Time `json:"created"`
+}
+
+// next returns the next time the entry should run after t
+func (e Entry) next(t time.Time) (time.Time, error) {
+	if e.Spec == "" {
+		return e.At, nil
+	}
+
+	c, err := ParseCron(e.Spec)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(e.Location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return c.Next(t.In(loc)), nil
+}
+
+var (
+	storeKey  = []byte("schedule#entries")
+	nextIDKey = []byte("schedule#next") // IDs are not reused after removal
+)
+
+type scheduler struct {
+	mx     *hugot.Mux
+	s      hugot.Storer
+	admins []string
+
+	sync.Mutex
+	next     map[int]time.Time
+	adapters map[int]hugot.Adapter // Adapters of schedules created since we started
+	now      func() time.Time
+}
+
+// New creates a schedule handler that runs commands on mx, storing the
+// schedules in s. The handler should be added to mx with Handle, so that
+// it can run in the background. Commands are run in the channel they were
+// scheduled from, only the admins, given by the user ID reported by the
+// adapter, may schedule commands to run in other channels.
+func New(mx *hugot.Mux, s hugot.Storer, admins ...string) hugot.Handler {
+	return &scheduler{
+		mx:       mx,
+		s:        s,
+		admins:   admins,
+		next:     map[int]time.Time{},
+		adapters: map[int]hugot.Adapter{},
+		now:      time.Now,
+	}
+}
+
+func (*scheduler) Describe() (string, string) {
+	return "schedule", "run commands on a cron schedule, or at a given time. Sub commands list and rm manage schedules"
+}
+
+func (sc *scheduler) load() ([]Entry, error) {
+	bs, ok, err := sc.s.Get(storeKey)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var es []Entry
+	err = json.Unmarshal(bs, &es)
+	return es, err
+}
+
+func (sc *scheduler) save(es []Entry) error {
+	bs, err := json.Marshal(es)
+	if err != nil {
+		return err
+	}
+	return sc.s.Set(storeKey, bs)
+}
+
+func (sc *scheduler) Command(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message) error {
+	at := m.String("at", "", "run once at this time, e.g. \"2016-12-25 09:00\" or \"17:30\"")
+	ch := m.String("c", "", "channel to run the command in, defaults to the current channel, admins only")
+	tz := m.String("tz", "Local", "time zone for the schedule")
+	if err := m.Parse(); err != nil {
+		return err
+	}
+
+	args := m.Args()
+	if len(args) > 0 {
+		switch args[0] {
+		case "list", "ls":
+			return sc.list(w, m)
+		case "rm", "remove":
+			return sc.remove(w, m, args[1:])
+		}
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		return err
+	}
+
+	e := Entry{
+		Location: *tz,
+		Channel:  m.Channel,
+		User:     m.From,
+		UserID:   m.UserID,
+		Private:  m.Private,
+		Created:  sc.now(),
+	}
+	if c := strings.TrimPrefix(*ch, "#"); c != "" && c != m.Channel {
+		if !sc.isAdmin(m) {
+			return errors.New("only admins may schedule commands in other channels")
+		}
+		e.Channel = c
+		e.Private = false
+	}
+
+	if *at != "" {
+		if e.At, err = parseAt(*at, sc.now().In(loc)); err != nil {
+			return err
+		}
+	} else {
+		if len(args) < 1 {
+			return errors.New("a cron expression, or -at time, is required")
+		}
+		if _, err := ParseCron(args[0]); err != nil {
+			return err
+		}
+		e.Spec = args[0]
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		return errors.New("no command given to schedule")
+	}
+	e.Command = quote(args)
+
+	next, err := e.next(sc.now())
+	if err != nil {
+		return err
+	}
+	if next.IsZero() {
+		return fmt.Errorf("%q will never run", e.Spec)
+	}
+
+	sc.Lock()
+	defer sc.Unlock()
+
+	es, err := sc.load()
+	if err != nil {
+		return err
+	}
+	if e.ID, err = sc.nextID(es); err != nil {
+		return err
+	}
+	if err := sc.save(append(es, e)); err != nil {
+		return err
+	}
+
+	sc.next[e.ID] = next
+	if a, ok := hugot.AdapterFromContext(ctx); ok {
+		sc.adapters[e.ID] = a
+	}
+
+	fmt.Fprintf(w, "scheduled %q as %d, next run at %s", e.Command, e.ID, next.Format(time.RFC1123))
+	return nil
+}
+
+// nextID allocates the ID for a new entry. Stores written before IDs were
+// recorded continue from the highest ID in es.
+func (sc *scheduler) nextID(es []Entry) (int, error) {
+	id := 0
+	bs, ok, err := sc.s.Get(nextIDKey)
+	switch {
+	case err != nil:
+		return 0, err
+	case ok:
+		if id, err = strconv.Atoi(string(bs)); err != nil {
+			return 0, err
+		}
+	}
+	for _, e := range es {
+		if e.ID >= id {
+			id = e.ID + 1
+		}
+	}
+	if err := sc.s.Set(nextIDKey, []byte(strconv.Itoa(id+1))); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// owns returns true if e was scheduled by the sender of m
+func owns(e Entry, m *hugot.Message) bool {
+	if e.UserID != "" || m.UserID != "" {
+		return e.UserID == m.UserID
+	}
+	return e.User == m.From
+}
+
+func (sc *scheduler) isAdmin(m *hugot.Message) bool {
+	if m.UserID == "" {
+		return false
+	}
+	for _, a := range sc.admins {
+		if a == m.UserID {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAt parses a time of day, or a date and time, relative to now.
+func parseAt(s string, now time.Time) (time.Time, error) {
+	for _, f := range []string{"2006-01-02 15:04", "2006-01-02T15:04", time.RFC3339} {
+		if t, err := time.ParseInLocation(f, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	t, err := time.ParseInLocation("15:04", s, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not understand time %q", s)
+	}
+	t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// quote reassembles a command line from its arguments, quoting any that
+// require it.
+func quote(args []string) string {
+	qs := make([]string, len(args))
+	for i, a := range args {
+		if a != "" && !strings.ContainsAny(a, " \t\n'\"\\|;&<>$`") {
+			qs[i] = a
+			continue
+		}
+		qs[i] = "'" + strings.Replace(a, "'", `'\''`, -1) + "'"
+	}
+	return strings.Join(qs, " ")
+}
+
+func (sc *scheduler) list(w hugot.ResponseWriter, m *hugot.Message) error {
+	sc.Lock()
+	defer sc.Unlock()
+
+	es, err := sc.load()
+	if err != nil {
+		return err
+	}
+
+	// Admins see every schedule, other users only their own
+	admin := sc.isAdmin(m)
+	found := false
+	buf := &bytes.Buffer{}
+	tw := new(tabwriter.Writer)
+	tw.Init(buf, 0, 8, 1, ' ', 0)
+	for _, e := range es {
+		if !admin && !owns(e, m) {
+			continue
+		}
+		found = true
+		when := e.Spec
+		if when == "" {
+			when = e.At.Format("2006-01-02 15:04 MST")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", e.ID, when, e.Channel, e.User, e.Command)
+	}
+	tw.Flush()
+
+	if !found {
+		fmt.Fprint(w, "nothing is scheduled")
+		return nil
+	}
+	fmt.Fprint(w, buf.String())
+	return nil
+}
+
+func (sc *scheduler) remove(w hugot.ResponseWriter, m *hugot.Message, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: schedule rm ID")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("bad schedule id %q", args[0])
+	}
+
+	sc.Lock()
+	defer sc.Unlock()
+
+	es, err := sc.load()
+	if err != nil {
+		return err
+	}
+	for i, e := range es {
+		if e.ID != id {
+			continue
+		}
+		if !owns(e, m) && !sc.isAdmin(m) {
+			return fmt.Errorf("schedule %d belongs to %s", id, e.User)
+		}
+		if err := sc.save(append(es[:i], es[i+1:]...)); err != nil {
+			return err
+		}
+		delete(sc.next, id)
+		delete(sc.adapters, id)
+		fmt.Fprintf(w, "removed schedule %d", id)
+		return nil
+	}
+
+	return fmt.Errorf("no schedule %d", id)
+}
+
+// StartBackground runs scheduled commands until ctx is cancelled.
+func (sc *scheduler) StartBackground(ctx context.Context, w hugot.ResponseWriter) {
+	t := time.NewTicker(10 * time.Second)
+	defer t.Stop()
+
+	for {
+		sc.runDue(ctx, w)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runDue runs any entries that are due, and works out when they should
+// next run.
+func (sc *scheduler) runDue(ctx context.Context, w hugot.ResponseWriter) {
+	sc.Lock()
+	defer sc.Unlock()
+
+	es, err := sc.load()
+	if err != nil {
+		glog.Errorf("could not load schedules, %v", err)
+		return
+	}
+
+	now := sc.now()
+	var keep []Entry
+	for _, e := range es {
+		next, ok := sc.next[e.ID]
+		if !ok {
+			// Schedules loaded from storage, run repeating schedules
+			// from now, and one off schedules that we missed.
+			if next, err = e.next(now); err != nil {
+				glog.Errorf("bad schedule %d, %v", e.ID, err)
+				continue
+			}
+			sc.next[e.ID] = next
+		}
+
+		if next.After(now) {
+			keep = append(keep, e)
+			continue
+		}
+
+		go sc.run(ctx, w, e, sc.adapters[e.ID])
+
+		if e.Spec == "" {
+			delete(sc.next, e.ID)
+			delete(sc.adapters, e.ID)
+			continue
+		}
+
+		sc.next[e.ID], _ = e.next(now)
+		keep = append(keep, e)
+	}
+
+	if len(keep) != len(es) {
+		if err := sc.save(keep); err != nil {
+			glog.Errorf("could not save schedules, %v", err)
+		}
+	}
+}
+
+// run replays the scheduled command through the mux, as if it had been
+// sent by the user that scheduled it.
+func (sc *scheduler) run(ctx context.Context, bgw hugot.ResponseWriter, e Entry, a hugot.Adapter) {
+	if a != nil {
+		ctx = hugot.NewAdapterContext(ctx, a)
+	}
+
+	w, ok := hugot.ResponseWriterFromContext(ctx)
+	if !ok {
+		w = bgw.Copy()
+	}
+	w.SetChannel(e.Channel)
+	if e.Private {
+		w.SetTo(e.User)
+	}
+
+	m := &hugot.Message{
+		Channel: e.Channel,
+		From:    e.User,
+		UserID:  e.UserID,
+		Private: e.Private,
+		ToBot:   true,
+		Text:    e.Command,
+	}
+
+	if glog.V(2) {
+		glog.Infof("running schedule %d, %q", e.ID, e.Command)
+	}
+	sc.mx.ProcessMessage(ctx, w, m)
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package schedule
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tcolgate/hugot"
+	"github.com/tcolgate/hugot/hugottest"
+	"github.com/tcolgate/hugot/storers/memory"
+)
+
+type testBot struct {
+	mx   *hugot.Mux
+	a    *hugottest.Adapter
+	ctx  context.Context
+	said chan string
+}
+
+func newTestBot() *testBot {
+	tb := &testBot{
+		mx:   hugot.NewMux("test", ""),
+		a:    hugottest.NewAdapter(),
+		said: make(chan string, 10),
+	}
+	tb.ctx = hugot.NewAdapterContext(context.Background(), tb.a)
+	tb.mx.HandleCommand(hugot.NewCommandHandler("say", "say something", func(ctx context.Context, w hugot.ResponseWriter, m *hugot.Message) error {
+		if err := m.Parse(); err != nil {
+			return err
+		}
+		tb.said <- m.Channel + ": " + strings.Join(m.Args(), " ")
+		return nil
+	}, nil))
+	return tb
+}
+
+// send processes txt as sent by the user, and returns the replies
+func (tb *testBot) send(from, id, txt string) string {
+	tb.a.ResponseRecorder.Messages = nil
+	w, _ := hugot.ResponseWriterFromContext(tb.ctx)
+	m := &hugot.Message{Channel: "ops", From: from, UserID: id, ToBot: true, Text: txt}
+	tb.mx.ProcessMessage(tb.ctx, w, m)
+
+	var out []string
+	for _, r := range tb.a.ResponseRecorder.Messages {
+		out = append(out, r.Text)
+	}
+	return strings.Join(out, "\n")
+}
+
+// ran collects n commands run by the scheduler
+func (tb *testBot) ran(t *testing.T, n int) []string {
+	var got []string
+	for i := 0; i < n; i++ {
+		select {
+		case s := <-tb.said:
+			got = append(got, s)
+		case <-time.After(time.Second):
+			t.Fatalf("expected %d commands to run, got %v", n, got)
+		}
+	}
+	select {
+	case s := <-tb.said:
+		t.Fatalf("unexpected command run, %q", s)
+	case <-time.After(50 * time.Millisecond):
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestScheduler(t *testing.T) {
+	now := time.Date(2016, 12, 23, 8, 0, 0, 0, time.UTC)
+	tb := newTestBot()
+	store := memory.New()
+	sc := New(tb.mx, store, "U9").(*scheduler)
+	sc.now = func() time.Time { return now }
+	tb.mx.Handle(sc)
+
+	tests := []struct {
+		from, id, txt string
+		exp           string
+	}{
+		{"bob", "U1", `schedule -tz UTC "0 9 * * *" say good morning`, "scheduled \"say good morning\" as 0"},
+		{"bob", "U1", `schedule -tz UTC -at 08:30 say once`, "scheduled \"say once\" as 1"},
+		{"bob", "U1", `schedule -tz UTC -c #dev "0 9 * * *" say hi`, "only admins"},
+		{"bob", "U1", `schedule -tz UTC -c #ops -at 10:00 say here`, "scheduled \"say here\" as 2"},
+		{"root", "U9", `schedule -tz UTC -c #dev "0 9 * * *" say hi`, "scheduled \"say hi\" as 3"},
+		{"root", "U9", "schedule list", "dev root say hi"},
+		{"alice", "U2", "schedule list", "nothing is scheduled"},
+		{"alice", "U2", "schedule rm 2", "schedule 2 belongs to bob"},
+		{"bob", "U1", "schedule rm 2", "removed schedule 2"},
+		{"bob", "U1", "schedule rm 2", "no schedule 2"},
+		{"bob", "U1", `schedule -tz UTC -c #ops -at 11:00 say later`, "scheduled \"say later\" as 4"},
+		{"root", "U9", "schedule rm 4", "removed schedule 4"},
+		{"bob", "U1", `schedule -tz UTC -c #ops -at 11:00 say later`, "scheduled \"say later\" as 5"},
+		{"root", "U9", "schedule rm 5", "removed schedule 5"},
+	}
+	for _, tt := range tests {
+		if got := tb.send(tt.from, tt.id, tt.txt); !strings.Contains(got, tt.exp) {
+			t.Errorf("%q: expected %q in %q", tt.txt, tt.exp, got)
+		}
+	}
+
+	w, _ := hugot.ResponseWriterFromContext(tb.ctx)
+
+	now = now.Add(45 * time.Minute)
+	sc.runDue(tb.ctx, w)
+	if got := tb.ran(t, 1); got[0] != "ops: once" {
+		t.Fatalf("expected the one off schedule to run, got %v", got)
+	}
+
+	now = now.Add(15 * time.Minute)
+	sc.runDue(tb.ctx, w)
+	if got := tb.ran(t, 2); got[0] != "dev: hi" || got[1] != "ops: good morning" {
+		t.Fatalf("expected the cron schedules to run, got %v", got)
+	}
+
+	sc.runDue(tb.ctx, w)
+	tb.ran(t, 0)
+
+	if out := tb.send("bob", "U1", "schedule list"); strings.Contains(out, "once") {
+		t.Fatalf("one off schedule should have been removed, got %q", out)
+	}
+	if out := tb.send("bob", "U1", "schedule list"); strings.Contains(out, "say hi") {
+		t.Fatalf("bob should only see their own schedules, got %q", out)
+	}
+}
+
+func TestScheduler_Restart(t *testing.T) {
+	now := time.Date(2016, 12, 23, 8, 0, 0, 0, time.UTC)
+	tb := newTestBot()
+	store := memory.New()
+
+	sc := New(tb.mx, store).(*scheduler)
+	sc.now = func() time.Time { return now }
+	tb.mx.Handle(sc)
+	tb.send("bob", "U1", `schedule -tz UTC "0 9 * * *" say good morning`)
+	tb.send("bob", "U1", `schedule -tz UTC -at 08:30 say once`)
+
+	// Restart, after both schedules should have run
+	now = now.Add(2 * time.Hour)
+	sc = New(tb.mx, store).(*scheduler)
+	sc.now = func() time.Time { return now }
+
+	w, _ := hugot.ResponseWriterFromContext(tb.ctx)
+	sc.runDue(context.Background(), w)
+	if got := tb.ran(t, 1); got[0] != "ops: once" {
+		t.Fatalf("expected the missed one off schedule to run, got %v", got)
+	}
+
+	now = time.Date(2016, 12, 24, 9, 0, 0, 0, time.UTC)
+	sc.runDue(context.Background(), w)
+	if got := tb.ran(t, 1); got[0] != "ops: good morning" {
+		t.Fatalf("expected the cron schedule to run the next day, got %v", got)
+	}
+}
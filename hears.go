@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"strings"
+
+	"context"
+)
+
+// HearsOptions control how a Hears handler is matched by a Mux.
+type HearsOptions struct {
+	// Handlers with a higher Priority are tried first. Handlers of equal
+	// priority are tried in the order they were added.
+	Priority int
+
+	// If an Exclusive handler matches a message, no further Hears handlers
+	// are tried.
+	Exclusive bool
+
+	// If Adapters is set, only messages from the named adapters are
+	// matched. Adapters are named by their package, e.g. "slack" or
+	// "irc", or by their full type, e.g. "*slack.slack".
+	Adapters []string
+
+	// If Channels is set, only messages in the listed channels are
+	// matched.
+	Channels []string
+
+	PublicOnly     bool // Only match messages in public channels
+	PrivateOnly    bool // Only match private messages
+	IgnoreToBot    bool // Do not match messages addressed to the bot
+	IgnoreCommands bool // Do not match messages that were run as commands
+
+	// MatchRaw matches, and passes to the handler, the text of the message
+	// as it was received, before any addressing of the bot was stripped.
+	MatchRaw bool
+}
+
+// HearsOptioner may be implemented by Hears handlers to provide the
+// options they are added with by HandleHears.
+type HearsOptioner interface {
+	HearsOptions() HearsOptions
+}
+
+type hearsEntry struct {
+	h    HearsHandler
+	opts HearsOptions
+}
+
+// applies checks if the scope of the handler permits it to hear m
+func (he hearsEntry) applies(ctx context.Context, m *Message) bool {
+	o := he.opts
+	switch {
+	case o.PublicOnly && m.Private,
+		o.PrivateOnly && !m.Private,
+		o.IgnoreToBot && m.ToBot:
+		return false
+	}
+
+	if len(o.Channels) > 0 && !contains(o.Channels, m.Channel) {
+		return false
+	}
+
+	if len(o.Adapters) > 0 {
+		an := AdapterName(ctx)
+		pkg := strings.TrimPrefix(an, "*")
+		if i := strings.Index(pkg, "."); i != -1 {
+			pkg = pkg[:i]
+		}
+		if !contains(o.Adapters, an) && !contains(o.Adapters, pkg) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// message returns the message to be matched against the handler
+func (he hearsEntry) message(m *Message) *Message {
+	mc := *m
+	if he.opts.MatchRaw && m.RawText != "" {
+		mc.Text = m.RawText
+	}
+	return &mc
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package hugot
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMux_HearsOrder(t *testing.T) {
+	mx := NewMux("test", "")
+
+	var mu sync.Mutex
+	var heard []string
+	hear := func(name, rx string) HearsHandler {
+		return NewHearsHandler(name, "", regexp.MustCompile(rx), func(ctx context.Context, w ResponseWriter, m *Message, matches [][]string) {
+			mu.Lock()
+			heard = append(heard, name)
+			mu.Unlock()
+		})
+	}
+
+	mx.HandleHears(hear("first", "deploy"))
+	mx.HandleHears(hear("second", "deploy"))
+	mx.HandleHearsWithOptions(hear("urgent", "deploy prod"), HearsOptions{Priority: 10, Exclusive: true})
+	mx.HandleHearsWithOptions(hear("late", "deploy"), HearsOptions{Priority: -1})
+
+	var names []string
+	for _, he := range mx.hears {
+		n, _ := he.h.Describe()
+		names = append(names, n)
+	}
+	if exp := []string{"urgent", "first", "second", "late"}; !reflect.DeepEqual(names, exp) {
+		t.Fatalf("expected order %v, got %v", exp, names)
+	}
+
+	run := func(txt string) []string {
+		mu.Lock()
+		heard = nil
+		mu.Unlock()
+
+		m := &Message{Channel: "ops", From: "bob", Text: txt}
+		mx.ProcessMessage(context.Background(), newResponseWriter(&testSender{}, *m, "test"), m)
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		sort.Strings(heard)
+		return heard
+	}
+
+	if got, exp := run("deploy prod please"), []string{"urgent"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected only %v to hear, got %v", exp, got)
+	}
+	if got, exp := run("deploy staging"), []string{"first", "late", "second"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected %v to hear, got %v", exp, got)
+	}
+}
+
+func TestHearsOptions_Scope(t *testing.T) {
+	ctx := NewAdapterContext(context.Background(), &testLimitedAdapter{})
+	tests := []struct {
+		opts HearsOptions
+		m    Message
+		exp  bool
+	}{
+		{HearsOptions{}, Message{Channel: "ops"}, true},
+		{HearsOptions{Channels: []string{"dev"}}, Message{Channel: "ops"}, false},
+		{HearsOptions{Channels: []string{"dev", "ops"}}, Message{Channel: "ops"}, true},
+		{HearsOptions{PublicOnly: true}, Message{Private: true}, false},
+		{HearsOptions{PrivateOnly: true}, Message{Private: true}, true},
+		{HearsOptions{PrivateOnly: true}, Message{}, false},
+		{HearsOptions{IgnoreToBot: true}, Message{ToBot: true}, false},
+		{HearsOptions{Adapters: []string{"hugot"}}, Message{}, true},
+		{HearsOptions{Adapters: []string{"*hugot.testLimitedAdapter"}}, Message{}, true},
+		{HearsOptions{Adapters: []string{"slack"}}, Message{}, false},
+	}
+
+	for i, tt := range tests {
+		if got := (hearsEntry{opts: tt.opts}).applies(ctx, &tt.m); got != tt.exp {
+			t.Errorf("%d: expected %v, got %v", i, tt.exp, got)
+		}
+	}
+
+	m := &Message{Text: "hello", RawText: "minion: hello"}
+	if mc := (hearsEntry{opts: HearsOptions{MatchRaw: true}}).message(m); mc.Text != m.RawText {
+		t.Errorf("expected raw text to be matched, got %q", mc.Text)
+	}
+}
@@ -20,6 +20,9 @@ func (mx *muxHelp) Describe() (string, string) {
 }
 
 func (mx *muxHelp) Command(ctx context.Context, w ResponseWriter, m *Message) error {
+	mx.p.RLock()
+	defer mx.p.RUnlock()
+
 	//capture the command we were called as
 	initcmd := m.args[0]
 	m.Parse()
@@ -50,19 +53,31 @@ func (mx *muxHelp) fullHelp(ctx context.Context, w ResponseWriter, m *Message) {
 		fmt.Fprintf(out, "Available commands are:\n")
 		_, _, hs := (*mx.p.cmds).List()
 		for _, h := range hs {
+			if r, ok := h.(*Router); ok {
+				ts, ds := r.Routes()
+				for i := range ts {
+					fmt.Fprintf(tw, "  %s\t - %s\n", ts[i], ds[i])
+				}
+				continue
+			}
 			n, d := h.Describe()
 			fmt.Fprintf(tw, "  %s\t - %s\n", n, d)
 		}
 		tw.Flush()
+
+		fmt.Fprintf(out, "Commands can be piped together with |, available filters are:\n")
+		for _, n := range []string{"grep", "head", "count"} {
+			_, d := pipeFilters[n].Describe()
+			fmt.Fprintf(tw, "  %s\t - %s\n", n, d)
+		}
+		tw.Flush()
 	}
 
 	if len(mx.p.hears) > 0 {
 		fmt.Fprintf(out, "Active hear handlers are patternss are:\n")
-		for r, hs := range mx.p.hears {
-			for _, h := range hs {
-				n, d := h.Describe()
-				fmt.Fprintf(tw, "  %s\t`%s`\t - %s\n", n, r.String(), d)
-			}
+		for _, he := range mx.p.hears {
+			n, d := he.h.Describe()
+			fmt.Fprintf(tw, "  %s\t`%s`\t - %s\n", n, he.h.Hears().String(), d)
 		}
 		tw.Flush()
 	}
@@ -126,6 +141,13 @@ func cmdUsage(c CommandHandler, cmdStr string, err error) error {
 	m.FlagSet.SetOutput(m.flagOut)
 
 	c.Command(context.TODO(), NewNullResponseWriter(*m), m)
+	if r, ok := c.(*Router); ok {
+		fmt.Fprintf(m.flagOut, "  Usage:\n")
+		ts, ds := r.Routes()
+		for i := range ts {
+			fmt.Fprintf(m.flagOut, "    %s - %s\n", ts[i], ds[i])
+		}
+	}
 	if subcx, ok := c.(CommandWithSubsHandler); ok {
 		subs := subcx.SubCommands()
 		if subs != nil && len(*subs) > 0 {
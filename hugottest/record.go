@@ -9,8 +9,9 @@ import (
 type ResponseRecorder struct {
 	Messages []hugot.Message
 
-	defchan string
-	defto   string
+	defchan   string
+	defto     string
+	defthread string
 }
 
 func (rr *ResponseRecorder) Send(ctx context.Context, m *hugot.Message) {
@@ -22,8 +23,9 @@ func (rr *ResponseRecorder) Send(ctx context.Context, m *hugot.Message) {
 
 func (rr *ResponseRecorder) Write(bs []byte) (int, error) {
 	nmsg := hugot.Message{
-		Channel: rr.defchan,
-		To:      rr.defto,
+		Channel:  rr.defchan,
+		To:       rr.defto,
+		ThreadID: rr.defthread,
 	}
 	nmsg.Text = string(bs)
 	rr.Send(context.TODO(), &nmsg)
@@ -38,6 +40,10 @@ func (rr *ResponseRecorder) SetTo(to string) {
 	rr.defto = to
 }
 
+func (rr *ResponseRecorder) SetThread(id string) {
+	rr.defthread = id
+}
+
 func (rr *ResponseRecorder) SetSender(a hugot.Sender) {
 	// Not sure if this is usefault
 }
@@ -0,0 +1,348 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"context"
+)
+
+// IntentFunc is called when a message matches an Intent. score is the
+// similarity of the message to the intent, between 0 and 1.
+type IntentFunc func(ctx context.Context, w ResponseWriter, m *Message, score float64)
+
+// Intent describes something a user may ask for, by example utterances,
+// and keywords.
+type Intent struct {
+	Name     string
+	Examples []string // Example messages, e.g. "what's the weather like"
+	Keywords []string // Words that identify the intent, e.g. "weather", "forecast"
+	F        IntentFunc
+}
+
+// IntentScore is the score of a message against an intent
+type IntentScore struct {
+	Intent string
+	Score  float64
+}
+
+type termVector map[string]float64
+
+// IntentHandler is a Hears handler that scores messages against a set of
+// intents, and calls the best matching intent, if its score is at least
+// the threshold. Messages are compared to examples using the cosine
+// similarity of their TF-IDF weighted, stemmed, terms. Misspelt words are
+// corrected to the nearest known term.
+//
+// The handler is also a command, which lists the intents, or shows the
+// scores of each intent for some text, to help with tuning examples.
+type IntentHandler struct {
+	Handler
+	threshold float64
+	intents   []Intent
+
+	idf      map[string]float64
+	examples [][]termVector // Weighted examples, per intent
+	keywords [][]string     // Stemmed keywords, per intent
+}
+
+var anyWord = regexp.MustCompile(`\w`)
+
+// NewIntentHandler creates a handler for the given intents. Scores range
+// between 0 and 1, a threshold of around 0.5 is a reasonable start.
+func NewIntentHandler(name, desc string, threshold float64, intents ...Intent) *IntentHandler {
+	ih := &IntentHandler{
+		Handler:   newBaseHandler(name, desc),
+		threshold: threshold,
+		intents:   intents,
+		idf:       map[string]float64{},
+	}
+
+	var docs [][]string
+	for _, in := range intents {
+		var kws []string
+		for _, k := range in.Keywords {
+			kws = append(kws, tokenize(k)...)
+		}
+		ih.keywords = append(ih.keywords, kws)
+
+		for _, e := range in.Examples {
+			docs = append(docs, tokenize(e))
+		}
+	}
+
+	df := map[string]int{}
+	for _, d := range docs {
+		seen := map[string]bool{}
+		for _, t := range d {
+			if !seen[t] {
+				df[t]++
+				seen[t] = true
+			}
+		}
+	}
+	for t, n := range df {
+		ih.idf[t] = math.Log(1 + float64(len(docs))/float64(n))
+	}
+
+	for _, in := range intents {
+		var vs []termVector
+		for _, e := range in.Examples {
+			vs = append(vs, ih.vector(tokenize(e)))
+		}
+		ih.examples = append(ih.examples, vs)
+	}
+
+	return ih
+}
+
+// vector returns the TF-IDF weighted, normalised, vector of terms.
+func (ih *IntentHandler) vector(ts []string) termVector {
+	v := termVector{}
+	for _, t := range ts {
+		if idf, ok := ih.idf[t]; ok {
+			v[t] += idf
+		}
+	}
+
+	var norm float64
+	for _, w := range v {
+		norm += w * w
+	}
+	norm = math.Sqrt(norm)
+	for t := range v {
+		v[t] /= norm
+	}
+	return v
+}
+
+// correct replaces unknown terms with a known term within an edit
+// distance of one, if there is one. Where several terms are that close,
+// the rarest, by idf, is preferred, then the first alphabetically.
+func (ih *IntentHandler) correct(ts []string) []string {
+	out := make([]string, len(ts))
+	for i, t := range ts {
+		out[i] = t
+		if _, ok := ih.idf[t]; ok || len(t) < 4 {
+			continue
+		}
+		best := ""
+		for k, idf := range ih.idf {
+			if !withinOneEdit(t, k) {
+				continue
+			}
+			if bidf := ih.idf[best]; best == "" || idf > bidf || (idf == bidf && k < best) {
+				best = k
+			}
+		}
+		if best != "" {
+			out[i] = best
+		}
+	}
+	return out
+}
+
+// Scores returns the score of txt against each intent, best first.
+func (ih *IntentHandler) Scores(txt string) []IntentScore {
+	ts := ih.correct(tokenize(txt))
+	v := ih.vector(ts)
+
+	present := map[string]bool{}
+	for _, t := range ts {
+		present[t] = true
+	}
+
+	var ss []IntentScore
+	for i, in := range ih.intents {
+		best := 0.0
+		for _, ev := range ih.examples[i] {
+			if s := cosine(v, ev); s > best {
+				best = s
+			}
+		}
+
+		if kws := ih.keywords[i]; len(kws) > 0 {
+			n := 0
+			for _, k := range kws {
+				if present[k] {
+					n++
+				}
+			}
+			if s := float64(n) / float64(len(kws)); s > best {
+				best = s
+			}
+		}
+
+		ss = append(ss, IntentScore{in.Name, best})
+	}
+
+	sort.SliceStable(ss, func(i, j int) bool { return ss[i].Score > ss[j].Score })
+	return ss
+}
+
+func cosine(a, b termVector) float64 {
+	var s float64
+	for t, w := range a {
+		s += w * b[t]
+	}
+	return s
+}
+
+// Hears implements HearsHandler, any message with words is considered.
+func (ih *IntentHandler) Hears() *regexp.Regexp {
+	return anyWord
+}
+
+// HearsOptions implements HearsOptioner. Messages that were run as
+// commands are not considered, so that an intent does not fire as well
+// as the command.
+func (ih *IntentHandler) HearsOptions() HearsOptions {
+	return HearsOptions{IgnoreCommands: true}
+}
+
+// Heard implements HearsHandler, and calls the best matching intent.
+func (ih *IntentHandler) Heard(ctx context.Context, w ResponseWriter, m *Message, submatches [][]string) {
+	ss := ih.Scores(m.Text)
+	if len(ss) == 0 || ss[0].Score < ih.threshold {
+		return
+	}
+
+	for _, in := range ih.intents {
+		if in.Name == ss[0].Intent && in.F != nil {
+			in.F(ctx, w, m, ss[0].Score)
+			return
+		}
+	}
+}
+
+// Command implements CommandHandler. With no arguments, the intents are
+// listed, otherwise the scores of the arguments against each intent are
+// shown.
+func (ih *IntentHandler) Command(ctx context.Context, w ResponseWriter, m *Message) error {
+	if err := m.Parse(); err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	tw := new(tabwriter.Writer)
+	tw.Init(buf, 0, 8, 1, ' ', 0)
+
+	if len(m.Args()) == 0 {
+		for _, in := range ih.intents {
+			fmt.Fprintf(tw, "%s\t%s\n", in.Name, strings.Join(append(in.Examples, in.Keywords...), ", "))
+		}
+	} else {
+		for _, s := range ih.Scores(strings.Join(m.Args(), " ")) {
+			mark := ""
+			if s.Score >= ih.threshold {
+				mark = "*"
+			}
+			fmt.Fprintf(tw, "%s\t%.2f\t%s\n", s.Intent, s.Score, mark)
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprint(w, buf.String())
+	return ErrSkipHears
+}
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "is": true, "are": true, "was": true,
+	"be": true, "to": true, "of": true, "and": true, "or": true, "in": true,
+	"on": true, "at": true, "for": true, "it": true, "its": true, "me": true,
+	"my": true, "i": true, "you": true, "your": true, "we": true, "our": true,
+	"please": true, "can": true, "could": true, "would": true, "do": true,
+	"does": true, "this": true, "that": true, "with": true, "what": true,
+	"s": true,
+}
+
+// tokenize splits txt into lower case, stemmed, terms, dropping common
+// words.
+func tokenize(txt string) []string {
+	fs := strings.FieldsFunc(strings.ToLower(txt), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	var ts []string
+	for _, f := range fs {
+		if stopWords[f] {
+			continue
+		}
+		ts = append(ts, stem(f))
+	}
+	return ts
+}
+
+var stemSuffixes = []string{"ational", "ization", "fulness", "ousness", "iveness", "ations", "ation", "ments", "ment", "ness", "ings", "ing", "edly", "ies", "ied", "ed", "ly", "es", "s"}
+
+// stem applies some simple suffix stripping, so that e.g. "deploying",
+// "deployed" and "deploys" are considered the same term.
+func stem(w string) string {
+	for _, s := range stemSuffixes {
+		if !strings.HasSuffix(w, s) || len(w)-len(s) < 3 {
+			continue
+		}
+		w = strings.TrimSuffix(w, s)
+		switch s {
+		case "ies", "ied":
+			w += "y"
+		}
+		// Undouble trailing consonants, e.g. "stopp" from "stopping"
+		if n := len(w); n > 3 && w[n-1] == w[n-2] && !strings.ContainsRune("aeiouls", rune(w[n-1])) {
+			w = w[:n-1]
+		}
+		return w
+	}
+	return w
+}
+
+// withinOneEdit checks if a can be transformed into b by at most one
+// insertion, deletion, substitution or transposition.
+func withinOneEdit(a, b string) bool {
+	la, lb := len(a), len(b)
+	if la > lb {
+		a, b, la, lb = b, a, lb, la
+	}
+	if lb-la > 1 {
+		return false
+	}
+
+	i := 0
+	for i < la && a[i] == b[i] {
+		i++
+	}
+	if i == la {
+		return true
+	}
+	if la == lb {
+		if a[i+1:] == b[i+1:] {
+			return true
+		}
+		// transposition
+		return i+1 < la && a[i] == b[i+1] && a[i+1] == b[i] && a[i+2:] == b[i+2:]
+	}
+	return a[i:] == b[i+1:]
+}
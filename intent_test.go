@@ -0,0 +1,98 @@
+package hugot
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIntentHandler_Scores(t *testing.T) {
+	ih := NewIntentHandler("intents", "test intents", 0.5,
+		Intent{Name: "weather", Examples: []string{"what's the weather like", "will it rain today"}, Keywords: []string{"forecast"}},
+		Intent{Name: "deploy", Examples: []string{"deploy the website", "please ship the new release to production"}},
+		Intent{Name: "lunch", Examples: []string{"where should we go for lunch", "I'm hungry"}},
+	)
+
+	tests := []struct {
+		txt string
+		exp string
+	}{
+		{"is it going to rain later?", "weather"},
+		{"what is the forecast", "weather"},
+		{"can you deploy the site", "deploy"},
+		{"shipping the release now", "deploy"},
+		{"so hungyr", "lunch"},
+	}
+
+	for _, tt := range tests {
+		ss := ih.Scores(tt.txt)
+		if ss[0].Intent != tt.exp || ss[0].Score < 0.5 {
+			t.Errorf("%q: expected %s, got %v", tt.txt, tt.exp, ss)
+		}
+	}
+
+	if ss := ih.Scores("the quarterly accounts"); ss[0].Score >= 0.5 {
+		t.Errorf("expected no intent to match, got %v", ss)
+	}
+}
+
+func TestStem(t *testing.T) {
+	for w, exp := range map[string]string{
+		"deploying": "deploy",
+		"deployed":  "deploy",
+		"deploys":   "deploy",
+		"stopping":  "stop",
+		"queries":   "query",
+		"rain":      "rain",
+	} {
+		if got := stem(w); got != exp {
+			t.Errorf("%s: expected %s, got %s", w, exp, got)
+		}
+	}
+}
+
+func TestIntentHandler_Correct(t *testing.T) {
+	ih := NewIntentHandler("intents", "test intents", 0.5,
+		Intent{Name: "cart", Examples: []string{"show my cart", "empty my cart"}},
+		Intent{Name: "card", Examples: []string{"update my card"}},
+		Intent{Name: "cord", Examples: []string{"where is the cord"}},
+	)
+
+	// card is rarer than cart, cord is as rare as card, but sorts later
+	for i := 0; i < 20; i++ {
+		if got := ih.correct([]string{"carx", "cord", "cxrd"}); !reflect.DeepEqual(got, []string{"card", "cord", "card"}) {
+			t.Fatalf("unexpected correction %v", got)
+		}
+	}
+}
+
+func TestMux_IntentIgnoresCommands(t *testing.T) {
+	fired := make(chan string, 10)
+	ih := NewIntentHandler("intents", "test intents", 0.5,
+		Intent{Name: "deploy", Examples: []string{"deploy the website"}, F: func(ctx context.Context, w ResponseWriter, m *Message, score float64) {
+			fired <- m.Text
+		}},
+	)
+
+	mx := NewMux("test", "")
+	mx.Handle(ih)
+	mx.HandleCommand(NewCommandHandler("deploy", "deploy things", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		return nil
+	}, nil))
+
+	ts := &testSender{}
+	for _, txt := range []string{"deploy website", "please deploy the website"} {
+		m := &Message{Channel: "ops", From: "bob", Text: txt, ToBot: true}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+	}
+
+	if got := <-fired; got != "please deploy the website" {
+		t.Fatalf("intent fired for a command, %q", got)
+	}
+	select {
+	case got := <-fired:
+		t.Fatalf("intent fired for a command, %q", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"context"
+)
+
+// job describes a running command invocation.
+type job struct {
+	ID      int
+	Command string
+	Channel string
+	User    string
+	UserID  string
+	Private bool
+	Started time.Time
+
+	cancel   context.CancelFunc
+	killedBy string
+}
+
+// errKilled is used internally to indicate a job was killed. The user
+// has already been told.
+var errKilled = errors.New("killed")
+
+// DefaultJobNotify is the default duration after which the user that
+// started a command is told when it finishes.
+var DefaultJobNotify = time.Minute
+
+// jobTable tracks the running commands of a mux
+type jobTable struct {
+	sync.Mutex
+	next   int
+	jobs   map[int]*job
+	notify time.Duration
+}
+
+func newJobTable() *jobTable {
+	return &jobTable{
+		next:   1,
+		jobs:   map[int]*job{},
+		notify: DefaultJobNotify,
+	}
+}
+
+type jobKeyType int
+
+var jobKey jobKeyType
+
+// jobIDFromContext returns the ID of the job running in ctx
+func jobIDFromContext(ctx context.Context) (int, bool) {
+	id, ok := ctx.Value(jobKey).(int)
+	return id, ok
+}
+
+// start registers a new job for m, the returned context is cancelled when
+// the job is killed, or done is called.
+func (jt *jobTable) start(ctx context.Context, m *Message) (context.Context, *job, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	jt.Lock()
+	j := &job{
+		ID:      jt.next,
+		Command: m.Text,
+		Channel: m.Channel,
+		User:    m.From,
+		UserID:  m.UserID,
+		Private: m.Private,
+		Started: time.Now(),
+		cancel:  cancel,
+	}
+	jt.jobs[j.ID] = j
+	jt.next++
+	jt.Unlock()
+
+	jobsRunning.Inc()
+
+	done := func() {
+		jt.Lock()
+		delete(jt.jobs, j.ID)
+		jt.Unlock()
+
+		jobsRunning.Dec()
+		cancel()
+	}
+
+	return context.WithValue(ctx, jobKey, j.ID), j, done
+}
+
+// list returns the running jobs, ordered by ID
+func (jt *jobTable) list() []job {
+	jt.Lock()
+	defer jt.Unlock()
+
+	var js []job
+	for _, j := range jt.jobs {
+		js = append(js, *j)
+	}
+	sort.Slice(js, func(i, k int) bool { return js[i].ID < js[k].ID })
+	return js
+}
+
+// kill cancels the job id on behalf of the sender of m. Only the user
+// that started a job may kill it.
+func (jt *jobTable) kill(id int, m *Message) error {
+	jt.Lock()
+	defer jt.Unlock()
+
+	j, ok := jt.jobs[id]
+	if !ok {
+		return fmt.Errorf("no job %d", id)
+	}
+	if !j.startedBy(m) {
+		return fmt.Errorf("job %d was started by %s", id, j.User)
+	}
+
+	j.killedBy = m.From
+	j.cancel()
+	return nil
+}
+
+// startedBy checks if j was started by the sender of m
+func (j *job) startedBy(m *Message) bool {
+	return j.User == m.From || (j.UserID != "" && j.UserID == m.UserID)
+}
+
+// killed returns who killed j, if anyone
+func (jt *jobTable) killed(j *job) string {
+	jt.Lock()
+	defer jt.Unlock()
+
+	return j.killedBy
+}
+
+// SetJobNotify sets the job notification duration of the DefaultMux
+func SetJobNotify(d time.Duration) {
+	DefaultMux.SetJobNotify(d)
+}
+
+// SetJobNotify sets the duration after which the user that started a
+// command will be told when it finishes. A duration of 0 disables
+// notifications.
+func (mx *Mux) SetJobNotify(d time.Duration) {
+	mx.jobs.Lock()
+	defer mx.jobs.Unlock()
+
+	mx.jobs.notify = d
+}
+
+// runJob runs f as a job on behalf of m, reporting on the outcome if the
+// job was killed, or ran long enough that the user may have stopped
+// waiting for it.
+func (mx *Mux) runJob(ctx context.Context, w ResponseWriter, m *Message, f func(context.Context) error) error {
+	ctx, j, done := mx.jobs.start(ctx, m)
+	err := f(ctx)
+	done()
+
+	mx.jobs.Lock()
+	notify := mx.jobs.notify
+	mx.jobs.Unlock()
+
+	took := time.Since(j.Started).Round(time.Second)
+	if by := mx.jobs.killed(j); by != "" {
+		fmt.Fprintf(w, "%s: job %d, %q, was killed by %s after %s", j.User, j.ID, j.Command, by, took)
+		return errKilled
+	}
+
+	if notify == 0 || time.Since(j.Started) < notify {
+		return err
+	}
+
+	switch err {
+	case nil, ErrSkipHears:
+		fmt.Fprintf(w, "%s: job %d, %q, finished after %s", j.User, j.ID, j.Command, took)
+	default:
+		fmt.Fprintf(w, "%s: job %d, %q, failed after %s", j.User, j.ID, j.Command, took)
+	}
+	return err
+}
+
+type jobsCommand struct {
+	mx *Mux
+}
+
+func (*jobsCommand) Describe() (string, string) {
+	return "jobs", "list running commands"
+}
+
+func (jc *jobsCommand) Command(ctx context.Context, w ResponseWriter, m *Message) error {
+	all := m.Bool("a", false, "show jobs for all users")
+	if err := m.Parse(); err != nil {
+		return err
+	}
+
+	self, _ := jobIDFromContext(ctx)
+
+	buf := &bytes.Buffer{}
+	tw := new(tabwriter.Writer)
+	tw.Init(buf, 0, 8, 1, ' ', 0)
+	found := false
+	for _, j := range jc.mx.jobs.list() {
+		mine := j.startedBy(m)
+		if j.ID == self || (!*all && !mine) {
+			continue
+		}
+		// Commands sent privately are not shown to other users
+		channel, cmd := j.Channel, j.Command
+		if j.Private && !mine {
+			channel, cmd = "-", "(private)"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n",
+			j.ID,
+			j.User,
+			channel,
+			time.Since(j.Started).Round(time.Second),
+			cmd)
+		found = true
+	}
+	tw.Flush()
+
+	if !found {
+		fmt.Fprint(w, "no jobs are running")
+		return nil
+	}
+	fmt.Fprint(w, buf.String())
+	return nil
+}
+
+type killCommand struct {
+	mx *Mux
+}
+
+func (*killCommand) Describe() (string, string) {
+	return "kill", "stop a running command, given its job id"
+}
+
+func (kc *killCommand) Command(ctx context.Context, w ResponseWriter, m *Message) error {
+	if err := m.Parse(); err != nil {
+		return err
+	}
+	if len(m.Args()) != 1 {
+		return errors.New("a single job id is required")
+	}
+
+	id, err := strconv.Atoi(m.Args()[0])
+	if err != nil {
+		return fmt.Errorf("bad job id %q", m.Args()[0])
+	}
+
+	return kc.mx.jobs.kill(id, m)
+}
@@ -0,0 +1,110 @@
+package hugot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMux_JobsKill(t *testing.T) {
+	mx := NewMux("test", "")
+	started := make(chan struct{})
+	mx.HandleCommand(NewCommandHandler("deploy", "deploy things", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, nil))
+
+	ts := &testSender{}
+	send := func(from, txt string) {
+		m := &Message{Channel: "ops", From: from, Text: txt, ToBot: true}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		send("bob", "deploy prod")
+		close(done)
+	}()
+	<-started
+
+	send("bob", "jobs")
+	if txts := ts.texts(); len(txts) != 1 || !strings.Contains(txts[0], "deploy prod") || strings.Contains(txts[0], "jobs") {
+		t.Fatalf("expected the deploy job to be listed, got %q", txts)
+	}
+
+	send("alice", "kill 1")
+	if txts := ts.texts(); len(txts) != 2 || !strings.Contains(txts[1], "started by bob") {
+		t.Fatalf("expected alice to be refused, got %q", txts)
+	}
+
+	send("bob", "kill 1")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job was not killed")
+	}
+	if txts := ts.texts(); len(txts) != 3 || !strings.Contains(txts[2], "was killed by bob") {
+		t.Fatalf("expected the kill to be reported, got %q", txts)
+	}
+
+	send("bob", "jobs")
+	if txts := ts.texts(); txts[len(txts)-1] != "no jobs are running" {
+		t.Fatalf("expected no running jobs, got %q", txts)
+	}
+}
+
+func TestMux_JobsPrivate(t *testing.T) {
+	mx := NewMux("test", "")
+	started := make(chan struct{})
+	mx.HandleCommand(NewCommandHandler("deploy", "deploy things", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, nil))
+
+	ts := &testSender{}
+	send := func(from, txt string, private bool) {
+		m := &Message{Channel: "D1", From: from, Text: txt, ToBot: true, Private: private}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		send("bob", "deploy prod --token=secret", true)
+		close(done)
+	}()
+	<-started
+
+	// The mux must not be held locked while the job runs
+	registered := make(chan struct{})
+	go func() {
+		mx.HandleCommand(NewCommandHandler("status", "show status", func(ctx context.Context, w ResponseWriter, m *Message) error {
+			return nil
+		}, nil))
+		close(registered)
+	}()
+	select {
+	case <-registered:
+	case <-time.After(time.Second):
+		t.Fatal("handler registration blocked by a running job")
+	}
+
+	send("alice", "jobs -a", false)
+	if txts := ts.texts(); len(txts) != 1 || strings.Contains(txts[0], "secret") || !strings.Contains(txts[0], "(private)") {
+		t.Fatalf("expected bob's private job to be redacted, got %q", txts)
+	}
+
+	send("bob", "jobs", true)
+	if txts := ts.texts(); len(txts) != 2 || !strings.Contains(txts[1], "deploy prod") {
+		t.Fatalf("expected bob to see their own job, got %q", txts)
+	}
+
+	send("bob", "kill 1", true)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job was not killed")
+	}
+}
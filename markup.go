@@ -0,0 +1,341 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Handlers may format message text using a neutral markup, which
+// adapters convert to the dialect of their chat system. Markup elements
+// are enclosed in braces:
+//
+//	{b:bold text}
+//	{i:italic text}
+//	{c:inline code}
+//	{pre:preformatted text}
+//	{link:http://example.com|the link text}
+//	{@user}
+//	{#channel}
+//
+// Bold and italic text may contain further markup. Within an element,
+// a backslash escapes the following character. Text outside of markup
+// elements is left untouched. The helper functions below build markup,
+// escaping their arguments where needed.
+
+// Bold formats markup as bold text
+func Bold(markup string) string {
+	return "{b:" + markup + "}"
+}
+
+// Italic formats markup as italic text
+func Italic(markup string) string {
+	return "{i:" + markup + "}"
+}
+
+// Code formats s as inline code
+func Code(s string) string {
+	return "{c:" + EscapeMarkup(s) + "}"
+}
+
+// Pre formats s as a block of preformatted text
+func Pre(s string) string {
+	return "{pre:" + EscapeMarkup(s) + "}"
+}
+
+// LinkTo formats a link to url, with the given text
+func LinkTo(url, text string) string {
+	return "{link:" + strings.Replace(EscapeMarkup(url), "|", `\|`, -1) + "|" + EscapeMarkup(text) + "}"
+}
+
+// MentionUser formats a mention of a user
+func MentionUser(u string) string {
+	return "{@" + EscapeMarkup(u) + "}"
+}
+
+// MentionChannel formats a mention of a channel
+func MentionChannel(c string) string {
+	return "{#" + EscapeMarkup(c) + "}"
+}
+
+var markupEscaper = strings.NewReplacer(`\`, `\\`, `{`, `\{`, `}`, `\}`)
+
+// EscapeMarkup escapes s so that it can be included in bold or italic
+// markup as literal text.
+func EscapeMarkup(s string) string {
+	return markupEscaper.Replace(s)
+}
+
+// MarkupKind identifies the type of a MarkupNode
+type MarkupKind int
+
+// The kinds of markup
+const (
+	MarkupText MarkupKind = iota
+	MarkupBold
+	MarkupItalic
+	MarkupCode
+	MarkupPre
+	MarkupLink
+	MarkupUser
+	MarkupChannel
+)
+
+// MarkupNode is an element of parsed markup
+type MarkupNode struct {
+	Kind     MarkupKind
+	Text     string       // Literal text, code, link text, or the user or channel name
+	URL      string       // The target of a link
+	Children []MarkupNode // The content of bold and italic text
+}
+
+var markupTags = []struct {
+	tag  string
+	kind MarkupKind
+}{
+	{"b:", MarkupBold},
+	{"i:", MarkupItalic},
+	{"c:", MarkupCode},
+	{"pre:", MarkupPre},
+	{"link:", MarkupLink},
+	{"@", MarkupUser},
+	{"#", MarkupChannel},
+}
+
+// ParseMarkup parses text containing neutral markup. Anything that is not
+// a complete markup element is returned as literal text.
+func ParseMarkup(s string) []MarkupNode {
+	ns, _, _ := parseMarkup(s, false)
+	return ns
+}
+
+// parseMarkup parses s until the end of the string, or, if inner is
+// true, an unescaped closing brace. The remaining text after the brace is
+// returned. ok is false if inner markup was not closed.
+func parseMarkup(s string, inner bool) (ns []MarkupNode, rest string, ok bool) {
+	lit := &bytes.Buffer{}
+	flush := func() {
+		if lit.Len() > 0 {
+			ns = append(ns, MarkupNode{Kind: MarkupText, Text: lit.String()})
+			lit.Reset()
+		}
+	}
+
+	for len(s) > 0 {
+		switch {
+		case inner && s[0] == '\\' && len(s) > 1:
+			lit.WriteByte(s[1])
+			s = s[2:]
+			continue
+		case inner && s[0] == '}':
+			flush()
+			return ns, s[1:], true
+		case s[0] == '{':
+			if n, r, ok := parseElement(s[1:]); ok {
+				flush()
+				ns = append(ns, n)
+				s = r
+				continue
+			}
+		}
+		lit.WriteByte(s[0])
+		s = s[1:]
+	}
+
+	flush()
+	return ns, "", !inner
+}
+
+// parseElement parses a markup element, following the opening brace
+func parseElement(s string) (MarkupNode, string, bool) {
+	for _, t := range markupTags {
+		if !strings.HasPrefix(s, t.tag) {
+			continue
+		}
+		s = s[len(t.tag):]
+
+		switch t.kind {
+		case MarkupBold, MarkupItalic:
+			cs, rest, ok := parseMarkup(s, true)
+			return MarkupNode{Kind: t.kind, Children: cs}, rest, ok
+		case MarkupLink:
+			url, d, rest, ok := unescapeUntil(s, "|}")
+			txt := ""
+			if ok && d == '|' {
+				txt, _, rest, ok = unescapeUntil(rest, "}")
+			}
+			return MarkupNode{Kind: t.kind, URL: url, Text: txt}, rest, ok && url != ""
+		default:
+			txt, _, rest, ok := unescapeUntil(s, "}")
+			return MarkupNode{Kind: t.kind, Text: txt}, rest, ok && txt != ""
+		}
+	}
+	return MarkupNode{}, "", false
+}
+
+// unescapeUntil returns the unescaped text of s up to the first
+// unescaped occurrence of one of the characters in end, that character,
+// and the remaining text following it.
+func unescapeUntil(s, end string) (string, byte, string, bool) {
+	buf := &bytes.Buffer{}
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			buf.WriteByte(s[i])
+		case strings.IndexByte(end, s[i]) != -1:
+			return buf.String(), s[i], s[i+1:], true
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+	return "", 0, "", false
+}
+
+// Dialect describes how a chat system formats each kind of markup. Any
+// functions that are nil are rendered as plain text.
+type Dialect struct {
+	Bold    func(s string) string
+	Italic  func(s string) string
+	Code    func(s string) string
+	Pre     func(s string) string
+	Link    func(url, text string) string
+	User    func(u string) string
+	Channel func(c string) string
+}
+
+// Render converts neutral markup to the dialect
+func (d Dialect) Render(markup string) string {
+	buf := &bytes.Buffer{}
+	d.render(buf, ParseMarkup(markup))
+	return buf.String()
+}
+
+func (d Dialect) render(buf *bytes.Buffer, ns []MarkupNode) {
+	apply := func(f func(string) string, s string) {
+		if f != nil {
+			s = f(s)
+		}
+		buf.WriteString(s)
+	}
+
+	for _, n := range ns {
+		switch n.Kind {
+		case MarkupText:
+			buf.WriteString(n.Text)
+		case MarkupBold, MarkupItalic:
+			inner := &bytes.Buffer{}
+			d.render(inner, n.Children)
+			if n.Kind == MarkupBold {
+				apply(d.Bold, inner.String())
+			} else {
+				apply(d.Italic, inner.String())
+			}
+		case MarkupCode:
+			apply(d.Code, n.Text)
+		case MarkupPre:
+			apply(d.Pre, n.Text)
+		case MarkupLink:
+			switch {
+			case d.Link != nil:
+				buf.WriteString(d.Link(n.URL, n.Text))
+			case n.Text == "" || n.Text == n.URL:
+				buf.WriteString(n.URL)
+			default:
+				buf.WriteString(n.Text + " <" + n.URL + ">")
+			}
+		case MarkupUser:
+			if d.User != nil {
+				buf.WriteString(d.User(n.Text))
+			} else {
+				buf.WriteString("@" + n.Text)
+			}
+		case MarkupChannel:
+			if d.Channel != nil {
+				buf.WriteString(d.Channel(n.Text))
+			} else {
+				buf.WriteString("#" + n.Text)
+			}
+		}
+	}
+}
+
+// PlainDialect renders markup as plain text
+var PlainDialect = Dialect{}
+
+// ANSIDialect renders markup using ANSI terminal escape codes
+var ANSIDialect = Dialect{
+	Bold:   func(s string) string { return "\x1b[1m" + s + "\x1b[22m" },
+	Italic: func(s string) string { return "\x1b[3m" + s + "\x1b[23m" },
+	Code:   func(s string) string { return "\x1b[36m" + s + "\x1b[39m" },
+	Pre:    func(s string) string { return "\x1b[36m" + s + "\x1b[39m" },
+	Link: func(url, text string) string {
+		if text == "" || text == url {
+			return "\x1b[4m" + url + "\x1b[24m"
+		}
+		return text + " <\x1b[4m" + url + "\x1b[24m>"
+	},
+	User:    func(u string) string { return "\x1b[1m@" + u + "\x1b[22m" },
+	Channel: func(c string) string { return "\x1b[1m#" + c + "\x1b[22m" },
+}
+
+// Formatter is implemented by adapters that convert neutral markup into
+// the formatting of their chat system. Text sent to adapters that do not
+// implement Formatter is rendered with the PlainDialect.
+type Formatter interface {
+	Format(markup string) string
+}
+
+// Format converts the neutral markup in the text of m, and its
+// attachments, for the sender s.
+func Format(s Sender, m *Message) *Message {
+	f := PlainDialect.Render
+	if fm, ok := s.(Formatter); ok {
+		f = fm.Format
+	}
+
+	nm := *m
+	nm.Text = f(m.Text)
+	if len(m.Attachments) == 0 {
+		return &nm
+	}
+
+	nm.Attachments = make([]Attachment, len(m.Attachments))
+	for i, a := range m.Attachments {
+		a.Pretext = f(a.Pretext)
+		a.Text = f(a.Text)
+
+		fs := make([]AttachmentField, len(a.Fields))
+		for j, fld := range a.Fields {
+			fld.Value = f(fld.Value)
+			fs[j] = fld
+		}
+		a.Fields = fs
+
+		ss := make([]Section, len(a.Sections))
+		for j, sec := range a.Sections {
+			sec.Text = f(sec.Text)
+			ss[j] = sec
+		}
+		a.Sections = ss
+
+		nm.Attachments[i] = a
+	}
+	return &nm
+}
@@ -0,0 +1,69 @@
+package hugot
+
+import (
+	"context"
+	"testing"
+)
+
+var testDialect = Dialect{
+	Bold:   func(s string) string { return "*" + s + "*" },
+	Italic: func(s string) string { return "_" + s + "_" },
+	Code:   func(s string) string { return "`" + s + "`" },
+	Link:   func(url, text string) string { return "[" + text + "](" + url + ")" },
+}
+
+func TestDialect_Render(t *testing.T) {
+	tests := []struct {
+		markup string
+		plain  string
+		md     string
+	}{
+		{"no markup {app} {b}", "no markup {app} {b}", "no markup {app} {b}"},
+		{Bold("deploy " + Italic("now")), "deploy now", "*deploy _now_*"},
+		{"run " + Code("a{b}c\\"), "run a{b}c\\", "run `a{b}c\\`"},
+		{LinkTo("http://x/?a|b", "the x"), "the x <http://x/?a|b>", "[the x](http://x/?a|b)"},
+		{"{link:http://x}", "http://x", "[](http://x)"},
+		{"hi " + MentionUser("bob") + " in " + MentionChannel("ops"), "hi @bob in #ops", "hi @bob in #ops"},
+		{"{b:unclosed", "{b:unclosed", "{b:unclosed"},
+		{"{@}", "{@}", "{@}"},
+	}
+
+	for _, tt := range tests {
+		if got := PlainDialect.Render(tt.markup); got != tt.plain {
+			t.Errorf("%q: expected plain %q, got %q", tt.markup, tt.plain, got)
+		}
+		if got := testDialect.Render(tt.markup); got != tt.md {
+			t.Errorf("%q: expected %q, got %q", tt.markup, tt.md, got)
+		}
+	}
+}
+
+type testFormatSender struct {
+	testSender
+}
+
+func (ts *testFormatSender) Format(s string) string {
+	return testDialect.Render(s)
+}
+
+func TestResponseWriter_Format(t *testing.T) {
+	m := &Message{
+		Text:        "deploy is " + Bold("done"),
+		Attachments: []Attachment{{Fields: []AttachmentField{{Title: "Status", Value: Italic("ok")}}}},
+	}
+
+	ts := &testFormatSender{}
+	newResponseWriter(ts, Message{}, "test").Send(context.Background(), m)
+	if got := ts.msgs[0]; got.Text != "deploy is *done*" || got.Attachments[0].Fields[0].Value != "_ok_" {
+		t.Errorf("expected formatted message, got %#v", got)
+	}
+	if m.Attachments[0].Fields[0].Value != Italic("ok") {
+		t.Errorf("original message should not be modified")
+	}
+
+	ps := &testSender{}
+	newResponseWriter(ps, Message{}, "test").Send(context.Background(), m)
+	if got := ps.texts(); got[0] != "deploy is done" {
+		t.Errorf("expected plain text, got %q", got)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+// MentionType identifies what was mentioned
+type MentionType int
+
+// The types of mention
+const (
+	UserMention MentionType = iota
+	ChannelMention
+)
+
+// Mention describes a user, or channel, mentioned in a message. Adapters
+// list the users and channels mentioned in incoming messages in the
+// message's Mentions, and replace any IDs used for them in the Text with
+// their names.
+type Mention struct {
+	Type MentionType
+	ID   string // The adapter's identifier for the user or channel
+	Name string // The name of the user or channel, as it appears in the text
+}
+
+// Markup returns neutral markup for the mention, that adapters will
+// render in their native syntax.
+func (mn Mention) Markup() string {
+	if mn.Type == ChannelMention {
+		return MentionChannel(mn.Name)
+	}
+	return MentionUser(mn.Name)
+}
+
+// Mentioned returns true if the user, given by name or ID, is mentioned
+// in m.
+func (m *Message) Mentioned(user string) bool {
+	for _, mn := range m.Mentions {
+		if mn.Type == UserMention && (mn.Name == user || mn.ID == user) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import "testing"
+
+func TestMessage_Mentioned(t *testing.T) {
+	m := &Message{
+		Text: "ask @bob in #ops",
+		Mentions: []Mention{
+			{Type: UserMention, ID: "U123", Name: "bob"},
+			{Type: ChannelMention, ID: "C456", Name: "ops"},
+		},
+	}
+
+	tests := []struct {
+		user string
+		exp  bool
+	}{
+		{"bob", true},
+		{"U123", true},
+		{"alice", false},
+		{"ops", false},
+		{"C456", false},
+	}
+
+	for _, tt := range tests {
+		if got := m.Mentioned(tt.user); got != tt.exp {
+			t.Errorf("Mentioned(%q) = %v, expected %v", tt.user, got, tt.exp)
+		}
+	}
+}
+
+func TestMention_Markup(t *testing.T) {
+	tests := []struct {
+		mn  Mention
+		exp string
+	}{
+		{Mention{Type: UserMention, ID: "U123", Name: "bob"}, "{@bob}"},
+		{Mention{Type: ChannelMention, ID: "C456", Name: "ops"}, "{#ops}"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.mn.Markup(); got != tt.exp {
+			t.Errorf("Markup() = %q, expected %q", got, tt.exp)
+		}
+		if got := PlainDialect.Render(tt.mn.Markup()); got[1:] != tt.mn.Name {
+			t.Errorf("rendered %q, expected name %q", got, tt.mn.Name)
+		}
+	}
+}
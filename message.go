@@ -21,25 +21,35 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
-
-	"github.com/nlopes/slack"
+	"io"
+	"strings"
 )
 
 // Message describes a Message from or to a user. It is intended to
 // provided a resonable lowest common denominator for modern chat systems.
-// It takes the Slack message format to provide that minimum but makes no
-// assumption about support for any markup.
+// Rich content may be added as Attachments, which adapters render natively,
+// or as plain text. No assumption is made about support for any markup.
 // If used within a command handler, the message can also be used as a flag.FlagSet
 // for adding and processing the message as a CLI command.
 type Message struct {
-	To      string
-	From    string
-	Channel string
+	ID       string // Adapter specific identifier of a sent or received message
+	ThreadID string // ID of the root message of the thread the message is in, if any
+	To       string
+	From     string
+	Channel  string
 
 	UserID string // Verified user identitify within the source adapter
 
 	Text        string // A plain text message
+	RawText     string // The text as received, before any addressing of the bot was stripped
 	Attachments []Attachment
+	Files       []File    // Files uploaded with the message, or to send with it
+	Mentions    []Mention // Users and channels mentioned in the Text
+
+	Input string // The output of the previous command in a pipeline
+
+	Reaction *Reaction // Set if the message reports a reaction to another message
+	Event    *Event    // Set if the message reports a chat event, such as a user joining
 
 	Private bool
 	ToBot   bool
@@ -52,17 +62,16 @@ type Message struct {
 	flagOut *bytes.Buffer
 }
 
-// Attachment represents a rich message attachment and is directly
-// modeled on the Slack attachments API
-type Attachment slack.Attachment
-
-// Reply returns a messsage with Text tx and the From and To fields switched
+// Reply returns a messsage with Text tx and the From and To fields switched.
+// If m is in a thread, the reply is sent to the same thread.
 func (m *Message) Reply(txt string) *Message {
 	out := *m
 	out.Text = txt
 
 	out.From = ""
 	out.To = m.From
+	out.Files = nil
+	out.Mentions = nil
 
 	return &out
 }
@@ -73,6 +82,21 @@ func (m *Message) Replyf(s string, is ...interface{}) *Message {
 	return m.Reply(fmt.Sprintf(s, is...))
 }
 
+// UserKey returns a string identifying the sender of m, preferring the
+// verified UserID where the adapter provides one.
+func (m *Message) UserKey() string {
+	if m.UserID != "" {
+		return m.UserID
+	}
+	return m.From
+}
+
+// Stdin returns a reader for the output of the previous command, when
+// the message is being processed as part of a pipeline.
+func (m *Message) Stdin() io.Reader {
+	return strings.NewReader(m.Input)
+}
+
 // Parse process any Args for this message in line with any flags that have
 // been added to the message.
 func (m *Message) Parse() error {
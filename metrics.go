@@ -13,9 +13,20 @@ var (
 		Help: "Number of messages received.",
 	},
 		[]string{"adapter", "channel", "user"})
+	rateLimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hugot_ratelimit_rejections_total",
+		Help: "Number of handler invocations rejected by rate limits.",
+	},
+		[]string{"scope", "handler"})
+	jobsRunning = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hugot_jobs_running",
+		Help: "Number of commands currently running.",
+	})
 )
 
 func init() {
 	prometheus.MustRegister(messagesTx)
 	prometheus.MustRegister(messagesRx)
+	prometheus.MustRegister(rateLimitRejections)
+	prometheus.MustRegister(jobsRunning)
 }
@@ -22,10 +22,11 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"regexp"
+	"sort"
 	"sync"
 
 	"github.com/golang/glog"
+	"github.com/tcolgate/hugot/storers/memory"
 
 	"context"
 )
@@ -45,13 +46,29 @@ type Mux struct {
 	burl *url.URL
 
 	*sync.RWMutex
-	hndlrs   []Handler                         // All the handlers
-	rhndlrs  []RawHandler                      // Raw handlers
-	bghndlrs []BackgroundHandler               // Long running background handlers
-	whhndlrs map[string]WebHookHandler         // WebHooks
-	hears    map[*regexp.Regexp][]HearsHandler // Hearing handlers
-	cmds     *CommandSet                       // Command handlers
-	httpm    *http.ServeMux                    // http Mux
+	hndlrs    []Handler                      // All the handlers
+	rhndlrs   []RawHandler                   // Raw handlers
+	bghndlrs  []BackgroundHandler            // Long running background handlers
+	whhndlrs  map[string]WebHookHandler      // WebHooks
+	hears     []hearsEntry                   // Hearing handlers, in the order they are tried
+	cmds      *CommandSet                    // Command handlers
+	convs     map[string]ConversationHandler // Conversation handlers
+	reactions []ReactionHandler              // Reaction handlers
+	events    []EventHandler                 // Event handlers
+	httpm     *http.ServeMux                 // http Mux
+
+	store  Storer       // Persistent storage for handler state
+	limits *rateLimiter // Rate limits on handler invocations
+	audit  *auditLog    // Audit log of executed commands
+	jobs   *jobTable    // Running commands
+	pages  *pageStore   // Unsent pages of long output
+	files  *fileStore   // Files served to adapters that cannot upload
+
+	threads map[string]bool // Handlers that reply in threads
+	reruns  map[string]bool // Commands that are run again when edited
+
+	trigger      *Trigger           // Overrides adapters' addressing of the bot
+	chanTriggers map[string]Trigger // Per channel overrides of trigger
 }
 
 // DefaultMux is a default Mux instance, http Handlers will be added to
@@ -67,12 +84,24 @@ func NewMux(name, desc string) *Mux {
 		rhndlrs:  []RawHandler{},
 		bghndlrs: []BackgroundHandler{},
 		whhndlrs: map[string]WebHookHandler{},
-		hears:    map[*regexp.Regexp][]HearsHandler{},
 		cmds:     NewCommandSet(),
+		convs:    map[string]ConversationHandler{},
 		httpm:    http.NewServeMux(),
 		burl:     &url.URL{Path: "/" + name},
+		store:    memory.New(),
+		limits:   newRateLimiter(),
+		jobs:     newJobTable(),
+		pages:    newPageStore(),
+		files:    newFileStore(),
+		threads:  map[string]bool{},
+		reruns:   map[string]bool{},
+
+		chanTriggers: map[string]Trigger{},
 	}
+	mx.httpm.Handle("/"+name+"/files/", mx.files)
 	mx.HandleCommand(&muxHelp{mx})
+	mx.HandleCommand(&jobsCommand{mx})
+	mx.HandleCommand(&killCommand{mx})
 	return mx
 }
 
@@ -121,6 +150,20 @@ func (mx *Mux) SetURL(b *url.URL) {
 	}
 }
 
+// SetStore sets the Storer used by the DefaultMux
+func SetStore(s Storer) {
+	DefaultMux.SetStore(s)
+}
+
+// SetStore sets the Storer used by this mux to persist state, such as
+// active conversations. By default state is only held in memory.
+func (mx *Mux) SetStore(s Storer) {
+	mx.Lock()
+	defer mx.Unlock()
+
+	mx.store = s
+}
+
 // StartBackground starts any registered background handlers.
 func (mx *Mux) StartBackground(ctx context.Context, w ResponseWriter) {
 	mx.Lock()
@@ -142,10 +185,15 @@ func (mx *Mux) SetAdapter(a Adapter) {
 }
 
 // ProcessMessage implements the Handler interface. Message will first be passed to
-// any registered RawHandlers. If the message has been deemed, by the Adapter
+// any registered RawHandlers. If the user asks for "more" of some paginated
+// output, the next page is sent. If the sending user has an active conversation
+// the message is passed to it, and no further processing is done, unless the
+// message is a command sent to the bot.
+// If the message has been deemed, by the Adapter
 // to have been sent directly to the bot, any comand handlers will be processed.
-// Then, if appropriate, the message will be matched against any Hears patterns
-// and all matching Heard functions will then be called.
+// Then, if appropriate, the message will be matched against any Hears patterns,
+// in order of priority, and matching Heard functions will then be called, until
+// an exclusive handler matches.
 // Any unrecognized errors from the Command handlers will be passed back to the
 // user that sent us the message.
 func (mx *Mux) ProcessMessage(ctx context.Context, w ResponseWriter, m *Message) error {
@@ -153,25 +201,66 @@ func (mx *Mux) ProcessMessage(ctx context.Context, w ResponseWriter, m *Message)
 	defer mx.RUnlock()
 	var err error
 
+	a, _ := AdapterFromContext(ctx)
+	mx.applyTrigger(a, m)
+
 	// We run all raw message handlers
 	for _, rh := range mx.rhndlrs {
 		mc := *m
 		go rh.ProcessMessage(ctx, w, &mc)
 	}
 
+	if m.Reaction != nil {
+		mx.react(ctx, w, m)
+		return nil
+	}
+
+	if m.Event != nil {
+		mx.event(ctx, w, m)
+		if m.Event.Type == EventEdited {
+			mx.rerun(ctx, w, m)
+		}
+		return nil
+	}
+
+	if mx.more(ctx, m) {
+		return nil
+	}
+	w = mx.pager(ctx, w, m)
+	w = mx.filer(ctx, w)
+
+	if ok, err := mx.converse(ctx, w, m); ok {
+		if err != nil {
+			fmt.Fprintf(w, "error, %s", err.Error())
+		}
+		return nil
+	}
+
+	ranCommand := false
 	if m.ToBot {
-		err = mx.cmds.NextCommand(ctx, w, m)
+		err = mx.command(ctx, w, m)
+		ranCommand = err != ErrUnknownCommand && err != ErrBadCLI
 	}
 
 	if err == ErrSkipHears {
 		return nil
 	}
 
-	for _, hhs := range mx.hears {
-		for _, hh := range hhs {
-			mc := *m
-			if runHearsHandler(ctx, hh, w, &mc) {
-				err = nil
+	for _, he := range mx.hears {
+		if !he.applies(ctx, m) || (ranCommand && he.opts.IgnoreCommands) {
+			continue
+		}
+		mc := he.message(m)
+		if !he.h.Hears().MatchString(mc.Text) {
+			continue
+		}
+		if !mx.allowHears(m, he.h) {
+			continue
+		}
+		if runHearsHandler(ctx, he.h, mx.threaded(w, m, he.h), mc) {
+			err = nil
+			if he.opts.Exclusive {
+				break
 			}
 		}
 	}
@@ -218,6 +307,21 @@ func (mx *Mux) Handle(h Handler) error {
 		used = true
 	}
 
+	if h, ok := h.(ConversationHandler); ok {
+		mx.HandleConversation(h)
+		used = true
+	}
+
+	if h, ok := h.(ReactionHandler); ok {
+		mx.HandleReaction(h)
+		used = true
+	}
+
+	if h, ok := h.(EventHandler); ok {
+		mx.HandleEvent(h)
+		used = true
+	}
+
 	mx.Lock()
 	defer mx.Unlock()
 
@@ -272,13 +376,32 @@ func HandleHears(h HearsHandler) error {
 
 // HandleHears adds the provided handler to the mux. All
 // messages matching the Hears patterns will be forwarded to
-// the handler.
+// the handler. If the handler implements HearsOptioner, it is
+// added with the options it provides.
 func (mx *Mux) HandleHears(h HearsHandler) error {
+	opts := HearsOptions{}
+	if ho, ok := h.(HearsOptioner); ok {
+		opts = ho.HearsOptions()
+	}
+	return mx.HandleHearsWithOptions(h, opts)
+}
+
+// HandleHearsWithOptions adds the provided handler to the DefaultMux
+func HandleHearsWithOptions(h HearsHandler, opts HearsOptions) error {
+	return DefaultMux.HandleHearsWithOptions(h, opts)
+}
+
+// HandleHearsWithOptions adds the provided handler to the mux, with
+// options controlling the order in which it is tried, whether any other
+// handlers are tried after it, and which messages it may hear.
+func (mx *Mux) HandleHearsWithOptions(h HearsHandler, opts HearsOptions) error {
 	mx.Lock()
 	defer mx.Unlock()
 
-	r := h.Hears()
-	mx.hears[r] = append(mx.hears[r], h)
+	mx.hears = append(mx.hears, hearsEntry{h, opts})
+	sort.SliceStable(mx.hears, func(i, j int) bool {
+		return mx.hears[i].opts.Priority > mx.hears[j].opts.Priority
+	})
 
 	return nil
 }
@@ -296,6 +419,22 @@ func (mx *Mux) HandleCommand(h CommandHandler) {
 	mx.cmds.AddCommandHandler(h)
 }
 
+// HandleConversation adds the provided handler to the DefaultMux
+func HandleConversation(h ConversationHandler) {
+	DefaultMux.HandleConversation(h)
+}
+
+// HandleConversation adds the provided handler to the mux. A command
+// with the name of the handler is added to start the conversation.
+func (mx *Mux) HandleConversation(h ConversationHandler) {
+	mx.Lock()
+	defer mx.Unlock()
+
+	n, _ := h.Describe()
+	mx.convs[n] = h
+	mx.cmds.AddCommandHandler(&conversationStarter{mx, h})
+}
+
 type webHookBridge struct {
 	nh http.Handler
 }
@@ -0,0 +1,331 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"context"
+)
+
+// DefaultPageTimeout is how long the remaining pages of long output are
+// kept for the user to ask for more.
+var DefaultPageTimeout = 5 * time.Minute
+
+// pageFooterLen is space reserved in each page for the "more" prompt
+const pageFooterLen = 64
+
+type pendingPages struct {
+	snd     Sender
+	pages   []*Message // Formatted, and addressed, pages
+	expires time.Time
+}
+
+// pageStore holds the unsent pages of output, per user and channel
+type pageStore struct {
+	sync.Mutex
+	timeout time.Duration
+	pending map[string]pendingPages
+	now     func() time.Time
+}
+
+func newPageStore() *pageStore {
+	return &pageStore{
+		timeout: DefaultPageTimeout,
+		pending: map[string]pendingPages{},
+		now:     time.Now,
+	}
+}
+
+func pageKey(m *Message) string {
+	return m.Channel + "#" + m.UserKey()
+}
+
+// set replaces any pending pages for key, they will be sent to snd
+func (ps *pageStore) set(key string, snd Sender, pages []*Message) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	now := ps.now()
+	for k, p := range ps.pending {
+		if now.After(p.expires) {
+			delete(ps.pending, k)
+		}
+	}
+
+	ps.pending[key] = pendingPages{snd: snd, pages: pages, expires: now.Add(ps.timeout)}
+}
+
+// next returns the next pending page for key, the sender to send it to,
+// and the number of pages that remain after it.
+func (ps *pageStore) next(key string) (*Message, Sender, int, bool) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	p, ok := ps.pending[key]
+	if !ok {
+		return nil, nil, 0, false
+	}
+	if ps.now().After(p.expires) {
+		delete(ps.pending, key)
+		return nil, nil, 0, false
+	}
+
+	page, rest := p.pages[0], p.pages[1:]
+	if len(rest) == 0 {
+		delete(ps.pending, key)
+	} else {
+		ps.pending[key] = pendingPages{snd: p.snd, pages: rest, expires: ps.now().Add(ps.timeout)}
+	}
+	return page, p.snd, len(rest), true
+}
+
+// SetPageTimeout sets the page timeout of the DefaultMux
+func SetPageTimeout(d time.Duration) {
+	DefaultMux.SetPageTimeout(d)
+}
+
+// SetPageTimeout sets how long the remaining pages of long output are
+// kept, waiting for the user to say "more".
+func (mx *Mux) SetPageTimeout(d time.Duration) {
+	mx.pages.Lock()
+	defer mx.pages.Unlock()
+
+	mx.pages.timeout = d
+}
+
+// paginate splits txt into pages of at most chars characters, and lines
+// lines. Pages are split at line breaks where possible.
+func paginate(txt string, chars, lines int) []string {
+	if chars > 0 {
+		chars -= pageFooterLen
+		if chars <= 0 {
+			chars = 1
+		}
+	}
+
+	var pages []string
+	var cur []string
+	curLen := 0
+	flush := func() {
+		if len(cur) > 0 {
+			pages = append(pages, strings.Join(cur, "\n"))
+		}
+		cur, curLen = nil, 0
+	}
+
+	for _, l := range strings.Split(txt, "\n") {
+		for chars > 0 && len(l) > chars {
+			// Split over long lines, without breaking runes
+			i := chars
+			for i > 0 && !isRuneStart(l[i]) {
+				i--
+			}
+			if i == 0 {
+				i = chars
+			}
+			flush()
+			pages = append(pages, l[:i])
+			l = l[i:]
+		}
+
+		if (lines > 0 && len(cur) >= lines) || (chars > 0 && curLen+len(l)+1 > chars) {
+			flush()
+		}
+		cur = append(cur, l)
+		curLen += len(l) + 1
+	}
+	flush()
+
+	return pages
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func morePrompt(n int) string {
+	if n == 1 {
+		return "\n(1 more page, say \"more\" to see it)"
+	}
+	return fmt.Sprintf("\n(%d more pages, say \"more\" to continue)", n)
+}
+
+// outbounder is implemented by writers that address the text written to
+// them, as responseWriter.outbound does.
+type outbounder interface {
+	outbound(m *Message) *Message
+}
+
+// pagingWriter splits long output written by handlers into pages, the
+// first is sent, and the rest are kept until the user asks for more.
+// Output is paginated after it has been formatted for the adapter, so
+// that markup is never split.
+type pagingWriter struct {
+	ResponseWriter
+	snd          Sender
+	an           string
+	ps           *pageStore
+	key          string
+	chars, lines int
+}
+
+// pager wraps w to paginate output, if the adapter in ctx limits the size
+// of messages.
+func (mx *Mux) pager(ctx context.Context, w ResponseWriter, m *Message) ResponseWriter {
+	a, ok := AdapterFromContext(ctx)
+	if !ok {
+		return w
+	}
+	pl, ok := a.(PageLimiter)
+	if !ok {
+		return w
+	}
+	chars, lines := pl.PageLimit()
+	if chars <= 0 && lines <= 0 {
+		return w
+	}
+
+	return newPagingWriter(w, a, AdapterName(ctx), mx.pages, pageKey(m), chars, lines)
+}
+
+func newPagingWriter(w ResponseWriter, snd Sender, an string, ps *pageStore, key string, chars, lines int) ResponseWriter {
+	if _, ok := w.(outbounder); !ok {
+		return w
+	}
+	return &pagingWriter{w, snd, an, ps, key, chars, lines}
+}
+
+func (w *pagingWriter) outbound(m *Message) *Message {
+	return w.ResponseWriter.(outbounder).outbound(m)
+}
+
+// Write implements io.Writer, the text is sent as a single message, and
+// is paginated if needed.
+func (w *pagingWriter) Write(bs []byte) (int, error) {
+	w.Send(context.TODO(), w.outbound(&Message{Text: string(bs)}))
+	return len(bs), nil
+}
+
+// Send implements Sender. The text of m is formatted for the adapter, and
+// the first page sent. Messages with files or attachments are not
+// paginated.
+func (w *pagingWriter) Send(ctx context.Context, m *Message) {
+	if len(m.Files) > 0 {
+		w.ResponseWriter.Send(ctx, m)
+		return
+	}
+
+	nm := Format(w.snd, textOnly(w.snd, m))
+	pages := paginate(nm.Text, w.chars, w.lines)
+	if len(pages) <= 1 || len(nm.Attachments) > 0 {
+		w.ResponseWriter.Send(ctx, m)
+		return
+	}
+
+	pms := make([]*Message, len(pages))
+	for i, p := range pages {
+		pm := *nm
+		pm.Text = p
+		pms[i] = &pm
+	}
+	w.ps.set(w.key, w.snd, pms[1:])
+
+	pms[0].Text += morePrompt(len(pms) - 1)
+	messagesTx.WithLabelValues(w.an, m.Channel, m.From).Inc()
+	w.snd.Send(ctx, pms[0])
+}
+
+// SetSender implements ResponseWriter
+func (w *pagingWriter) SetSender(s Sender) {
+	w.snd = s
+	w.ResponseWriter.SetSender(s)
+}
+
+// Copy returns a copy of this writer, that also paginates its output
+func (w *pagingWriter) Copy() ResponseWriter {
+	return newPagingWriter(w.ResponseWriter.Copy(), w.snd, w.an, w.ps, w.key, w.chars, w.lines)
+}
+
+// Post implements Editor, edited messages are not paginated.
+func (w *pagingWriter) Post(ctx context.Context, m *Message) (string, error) {
+	if e, ok := w.ResponseWriter.(Editor); ok {
+		return e.Post(ctx, m)
+	}
+	return Post(ctx, w.ResponseWriter, m.Text)
+}
+
+// Update implements Editor
+func (w *pagingWriter) Update(ctx context.Context, m *Message) error {
+	if e, ok := w.ResponseWriter.(Editor); ok {
+		return e.Update(ctx, m)
+	}
+	return Update(ctx, w.ResponseWriter, m.ID, m.Text)
+}
+
+// Delete implements Editor
+func (w *pagingWriter) Delete(ctx context.Context, m *Message) error {
+	if e, ok := w.ResponseWriter.(Editor); ok {
+		return e.Delete(ctx, m)
+	}
+	return nil
+}
+
+// React implements Reactor
+func (w *pagingWriter) React(ctx context.Context, m *Message, emoji string) error {
+	return React(ctx, w.ResponseWriter, m, emoji)
+}
+
+// Unreact implements Reactor
+func (w *pagingWriter) Unreact(ctx context.Context, m *Message, emoji string) error {
+	return Unreact(ctx, w.ResponseWriter, m, emoji)
+}
+
+// Upload implements Uploader
+func (w *pagingWriter) Upload(ctx context.Context, m *Message, f File) error {
+	if u, ok := w.ResponseWriter.(Uploader); ok {
+		return u.Upload(ctx, m, f)
+	}
+	return ErrNoUploads
+}
+
+// more sends the next page of output for the sender of m, if there is
+// one waiting. Pages have already been formatted, so are sent directly
+// to the adapter.
+func (mx *Mux) more(ctx context.Context, m *Message) bool {
+	if strings.TrimSpace(m.Text) != "more" {
+		return false
+	}
+
+	page, snd, n, ok := mx.pages.next(pageKey(m))
+	if !ok {
+		return false
+	}
+	if n > 0 {
+		pm := *page
+		pm.Text += morePrompt(n)
+		page = &pm
+	}
+
+	messagesTx.WithLabelValues(AdapterName(ctx), page.Channel, page.From).Inc()
+	snd.Send(ctx, page)
+	return true
+}
@@ -0,0 +1,106 @@
+package hugot
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		txt          string
+		chars, lines int
+		exp          []string
+	}{
+		{"a\nb\nc\nd\ne", 0, 2, []string{"a\nb", "c\nd", "e"}},
+		{"short", 0, 2, []string{"short"}},
+		{strings.Repeat("x", 70), pageFooterLen + 30, 0, []string{strings.Repeat("x", 30), strings.Repeat("x", 30), strings.Repeat("x", 10)}},
+		{"aaaa\nbbbb\ncccc", pageFooterLen + 10, 0, []string{"aaaa\nbbbb", "cccc"}},
+	}
+
+	for _, tt := range tests {
+		if got := paginate(tt.txt, tt.chars, tt.lines); !reflect.DeepEqual(got, tt.exp) {
+			t.Errorf("%q: expected %q, got %q", tt.txt, tt.exp, got)
+		}
+	}
+}
+
+type testLimitedAdapter struct {
+	testSender
+}
+
+func (*testLimitedAdapter) Receive() <-chan *Message { return nil }
+func (*testLimitedAdapter) PageLimit() (int, int)    { return 0, 2 }
+
+func TestMux_More(t *testing.T) {
+	mx := NewMux("test", "")
+	mx.HandleCommand(NewCommandHandler("lines", "print some lines", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		fmt.Fprint(w, "1\n2\n3\n4\n5")
+		return nil
+	}, nil))
+
+	ta := &testLimitedAdapter{}
+	ctx := NewAdapterContext(context.Background(), ta)
+	send := func(txt string, tobot bool) {
+		m := &Message{Channel: "ops", From: "bob", Text: txt, ToBot: tobot}
+		mx.ProcessMessage(ctx, newResponseWriter(ta, *m, "test"), m)
+	}
+
+	send("lines", true)
+	send("more", false)
+	send("more", true)
+	send("more", true)
+
+	exp := []string{
+		"1\n2" + morePrompt(2),
+		"3\n4" + morePrompt(1),
+		"5",
+		"error, unknown command",
+	}
+	if got := ta.texts(); !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected %q, got %q", exp, got)
+	}
+}
+
+func TestMux_MoreFormatted(t *testing.T) {
+	mx := NewMux("test", "")
+	mx.HandleCommand(NewCommandHandler("pre", "print preformatted lines", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		fmt.Fprint(w, Pre("1\n2\n3"))
+		return nil
+	}, nil))
+	mx.HandleCommand(NewCommandHandler("copy", "print lines via a copied writer", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		cw := w.Copy()
+		cw.SetChannel("dev")
+		fmt.Fprint(cw, "a\nb\nc")
+		return nil
+	}, nil))
+
+	ta := &testLimitedAdapter{}
+	ctx := NewAdapterContext(context.Background(), ta)
+	send := func(txt string) {
+		m := &Message{Channel: "ops", From: "bob", Text: txt, ToBot: true}
+		mx.ProcessMessage(ctx, newResponseWriter(ta, *m, "test"), m)
+	}
+
+	send("pre")
+	send("more")
+	send("copy")
+	send("more")
+
+	exp := []string{
+		"1\n2" + morePrompt(1),
+		"3",
+		"a\nb" + morePrompt(1),
+		"c",
+	}
+	if got := ta.texts(); !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected %q, got %q", exp, got)
+	}
+	for _, m := range ta.msgs[2:] {
+		if m.Channel != "dev" {
+			t.Errorf("expected copied output in dev, got %q", m.Channel)
+		}
+	}
+}
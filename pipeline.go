@@ -0,0 +1,291 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"context"
+
+	"github.com/mattn/go-shellwords"
+)
+
+// ErrEmptyPipe is returned if one of the commands in a pipeline is empty,
+// e.g. "deploy status |"
+var ErrEmptyPipe = errors.New("empty command in pipeline")
+
+// ErrShellMeta is returned if a command line includes an unquoted ;, &,
+// < or >. Only pipes are supported between commands, so these must be
+// quoted to be passed as arguments.
+var ErrShellMeta = ErrUsage{"only | may be used between commands, quote ;, &, < and > to pass them as arguments"}
+
+// errThrottled is used internally to indicate a command was rejected by
+// a rate limit. The user has already been told.
+var errThrottled = errors.New("rate limited")
+
+type pipeStage struct {
+	text string
+	args []string
+	h    CommandHandler
+}
+
+// splitPipeline splits txt into the individual commands of a pipeline.
+// Quoting follows the usual shellwords rules, so a quoted | is not
+// treated as a pipe. Other unquoted shell metacharacters are rejected,
+// rather than silently dropping the rest of the line.
+func splitPipeline(txt string) ([]pipeStage, error) {
+	var stages []pipeStage
+	rest := txt
+	for {
+		p := shellwords.NewParser()
+		args, err := p.Parse(rest)
+		if err != nil {
+			return nil, ErrBadCLI
+		}
+
+		rs := []rune(rest)
+		if p.Position < 0 {
+			return append(stages, pipeStage{text: rest, args: args}), nil
+		}
+		if rs[p.Position] != '|' {
+			return nil, ErrShellMeta
+		}
+
+		if len(args) == 0 {
+			return nil, ErrEmptyPipe
+		}
+		stages = append(stages, pipeStage{text: string(rs[:p.Position]), args: args})
+
+		rest = string(rs[p.Position+1:])
+		if strings.TrimSpace(rest) == "" {
+			return nil, ErrEmptyPipe
+		}
+	}
+}
+
+// command runs the command, or pipeline of commands, in m, as a job, and
+// records the invocation to any audit log. It must be called with the mux
+// read locked. The lock is released while the commands run, so that a long
+// running command does not hold up changes to the mux, or a kill.
+func (mx *Mux) command(ctx context.Context, w ResponseWriter, m *Message) error {
+	start := time.Now()
+
+	stages, err := splitPipeline(m.Text)
+	if err == nil {
+		err = mx.resolve(stages)
+	}
+	if err == nil {
+		err = mx.allowPipeline(w, m, stages)
+	}
+	if err == nil {
+		w = mx.threaded(w, m, stages[0].h)
+
+		mx.RUnlock()
+		err = mx.runJob(ctx, w, m, func(ctx context.Context) error {
+			return runPipeline(ctx, w, m, stages)
+		})
+		mx.RLock()
+	}
+
+	mx.recordAudit(ctx, m, stages, start, err)
+
+	if err == errThrottled || err == errKilled {
+		return ErrSkipHears
+	}
+	return err
+}
+
+// resolve finds the handler for each stage of a pipeline. The built in
+// filters take precedence over registered commands in all but the first
+// stage.
+func (mx *Mux) resolve(stages []pipeStage) error {
+	for i := range stages {
+		s := &stages[i]
+		if len(s.args) == 0 {
+			cmds, _, _ := mx.cmds.List()
+			return fmt.Errorf("required sub-command missing: %s", strings.Join(cmds, ", "))
+		}
+		if f, ok := pipeFilters[s.args[0]]; ok && i > 0 {
+			s.h = f
+			continue
+		}
+		h, err := mx.cmds.Lookup(s.args[0])
+		if err != nil {
+			return err
+		}
+		s.h = h
+	}
+	return nil
+}
+
+// allowPipeline checks the rate limits for each command of a pipeline.
+// The built in filters are not limited.
+func (mx *Mux) allowPipeline(w ResponseWriter, m *Message, stages []pipeStage) error {
+	for i, s := range stages {
+		if _, ok := pipeFilters[s.args[0]]; ok && i > 0 {
+			continue
+		}
+		if ok, wait := mx.allow(m, s.h); !ok {
+			fmt.Fprintf(w, "sorry %s, you're doing that too often, please try again in %s", m.From, wait.Round(time.Second))
+			return errThrottled
+		}
+	}
+	return nil
+}
+
+// runPipeline runs the commands of a pipeline. The output of each command
+// is made available to the next via its Input.
+func runPipeline(ctx context.Context, w ResponseWriter, m *Message, stages []pipeStage) error {
+	if len(stages) == 1 {
+		m.args = stages[0].args
+		return runCommandHandler(ctx, stages[0].h, w, m)
+	}
+
+	input := ""
+	for i, s := range stages {
+		sm := *m
+		sm.Text = strings.TrimSpace(s.text)
+		sm.Input = input
+		sm.args = s.args
+
+		if i == len(stages)-1 {
+			return runCommandHandler(ctx, s.h, w, &sm)
+		}
+
+		bw := newBufferResponseWriter(w)
+		if err := runCommandHandler(ctx, s.h, bw, &sm); err != nil && err != ErrSkipHears {
+			return err
+		}
+		input = bw.String()
+	}
+
+	return nil
+}
+
+// bufferResponseWriter collects the text of all messages sent to it, so
+// that they can be passed to the next command in a pipeline.
+type bufferResponseWriter struct {
+	parent ResponseWriter
+	buf    *bytes.Buffer
+}
+
+func newBufferResponseWriter(parent ResponseWriter) *bufferResponseWriter {
+	return &bufferResponseWriter{parent, &bytes.Buffer{}}
+}
+
+func (w *bufferResponseWriter) Write(bs []byte) (int, error) {
+	w.Send(context.TODO(), &Message{Text: string(bs)})
+	return len(bs), nil
+}
+
+func (w *bufferResponseWriter) Send(ctx context.Context, m *Message) {
+	if w.buf.Len() > 0 {
+		w.buf.WriteString("\n")
+	}
+	w.buf.WriteString(strings.TrimRight(m.Text, "\n"))
+}
+
+func (w *bufferResponseWriter) SetChannel(c string) {}
+func (w *bufferResponseWriter) SetTo(to string)     {}
+func (w *bufferResponseWriter) SetSender(a Sender)  {}
+func (w *bufferResponseWriter) SetThread(id string) {}
+
+// Copy returns a copy of the parent writer, output sent after the
+// command has completed can no longer be passed down the pipeline.
+func (w *bufferResponseWriter) Copy() ResponseWriter {
+	return w.parent.Copy()
+}
+
+func (w *bufferResponseWriter) String() string {
+	return w.buf.String()
+}
+
+// pipeFilters are the built in commands available for use in pipelines.
+var pipeFilters = map[string]CommandHandler{
+	"grep":  NewCommandHandler("grep", "print lines of input matching a pattern", grepFilter, nil),
+	"head":  NewCommandHandler("head", "print the first lines of input", headFilter, nil),
+	"count": NewCommandHandler("count", "count the lines of input", countFilter, nil),
+}
+
+func inputLines(m *Message) []string {
+	if m.Input == "" {
+		return nil
+	}
+	return strings.Split(m.Input, "\n")
+}
+
+func grepFilter(ctx context.Context, w ResponseWriter, m *Message) error {
+	v := m.Bool("v", false, "select non-matching lines")
+	i := m.Bool("i", false, "ignore case")
+	if err := m.Parse(); err != nil {
+		return err
+	}
+	if m.NArg() != 1 {
+		return errors.New("grep requires a single pattern")
+	}
+
+	pat := m.Arg(0)
+	if *i {
+		pat = "(?i)" + pat
+	}
+	r, err := regexp.Compile(pat)
+	if err != nil {
+		return err
+	}
+
+	var out []string
+	for _, l := range inputLines(m) {
+		if r.MatchString(l) != *v {
+			out = append(out, l)
+		}
+	}
+	if len(out) > 0 {
+		fmt.Fprint(w, strings.Join(out, "\n"))
+	}
+	return nil
+}
+
+func headFilter(ctx context.Context, w ResponseWriter, m *Message) error {
+	n := m.Int("n", 10, "number of lines")
+	if err := m.Parse(); err != nil {
+		return err
+	}
+
+	ls := inputLines(m)
+	if len(ls) > *n {
+		ls = ls[:*n]
+	}
+	if len(ls) > 0 {
+		fmt.Fprint(w, strings.Join(ls, "\n"))
+	}
+	return nil
+}
+
+func countFilter(ctx context.Context, w ResponseWriter, m *Message) error {
+	if err := m.Parse(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%d", len(inputLines(m)))
+	return nil
+}
@@ -0,0 +1,72 @@
+package hugot
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSplitPipeline(t *testing.T) {
+	tests := []struct {
+		txt  string
+		args [][]string
+		err  error
+	}{
+		{"deploy status", [][]string{{"deploy", "status"}}, nil},
+		{"deploy status | grep failed", [][]string{{"deploy", "status"}, {"grep", "failed"}}, nil},
+		{`echo "a | b" | count`, [][]string{{"echo", "a | b"}, {"count"}}, nil},
+		{"deploy status | grep -v ok | head -n 2", [][]string{{"deploy", "status"}, {"grep", "-v", "ok"}, {"head", "-n", "2"}}, nil},
+		{"deploy status |", nil, ErrEmptyPipe},
+		{"| grep failed", nil, ErrEmptyPipe},
+		{`echo "unterminated | grep`, nil, ErrBadCLI},
+		{"deploy status; rm -rf /", nil, ErrShellMeta},
+		{"deploy status | grep ok > out", nil, ErrShellMeta},
+		{"deploy prod & deploy dev", nil, ErrShellMeta},
+		{`echo "a; b" '<c>' d\&e`, [][]string{{"echo", "a; b", "<c>", "d&e"}}, nil},
+	}
+
+	for _, tt := range tests {
+		ss, err := splitPipeline(tt.txt)
+		if err != tt.err {
+			t.Fatalf("%q: expected error %v, got %v", tt.txt, tt.err, err)
+		}
+		var args [][]string
+		for _, s := range ss {
+			args = append(args, s.args)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Fatalf("%q: expected %#v, got %#v", tt.txt, tt.args, args)
+		}
+	}
+}
+
+func TestMux_Pipeline(t *testing.T) {
+	mx := NewMux("test", "")
+	mx.HandleCommand(NewCommandHandler("status", "list statuses", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		fmt.Fprint(w, "web ok\ndb failed")
+		fmt.Fprint(w, "cache failed")
+		return nil
+	}, nil))
+
+	tests := []struct {
+		txt string
+		exp string
+	}{
+		{"status | grep failed", "db failed\ncache failed"},
+		{"status | grep failed | count", "2"},
+		{"status | grep -v failed", "web ok"},
+		{"status | head -n 1", "web ok"},
+	}
+
+	for _, tt := range tests {
+		ts := &testSender{}
+		m := &Message{Channel: "ops", From: "bob", Text: tt.txt, ToBot: true}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+
+		got := ts.texts()
+		if len(got) != 1 || got[0] != tt.exp {
+			t.Fatalf("%q: expected %q, got %#v", tt.txt, tt.exp, got)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimit describes a token bucket. Up to Burst invocations are
+// permitted at once, with a further invocation becoming available every
+// Every. The zero RateLimit imposes no limit.
+type RateLimit struct {
+	Every time.Duration
+	Burst int
+}
+
+func (rl RateLimit) unlimited() bool {
+	return rl.Burst <= 0 || rl.Every <= 0
+}
+
+type bucket struct {
+	rl     RateLimit
+	tokens float64
+	last   time.Time
+}
+
+// fill tops up the bucket for the time that has passed since it was
+// last used, and reports whether it is now full.
+func (b *bucket) fill(now time.Time) bool {
+	b.tokens += float64(now.Sub(b.last)) / float64(b.rl.Every)
+	b.last = now
+	if b.tokens >= float64(b.rl.Burst) {
+		b.tokens = float64(b.rl.Burst)
+		return true
+	}
+	return false
+}
+
+// maxBuckets is the number of buckets we will track before discarding
+// any that have refilled completely.
+const maxBuckets = 1024
+
+// rateLimiter applies token bucket limits per user, per channel and per
+// user of a specific handler.
+type rateLimiter struct {
+	sync.Mutex
+	user     RateLimit
+	channel  RateLimit
+	handlers map[string]RateLimit
+
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		handlers: map[string]RateLimit{},
+		buckets:  map[string]*bucket{},
+		now:      time.Now,
+	}
+}
+
+type limitCheck struct {
+	scope string
+	key   string
+	rl    RateLimit
+}
+
+// allow reports whether the user may invoke the named command handler in
+// the given channel. If not, the scope of the limit that was hit, and how
+// long until it will next permit an invocation, are returned. A token is
+// only taken if all limits permit the invocation.
+func (r *rateLimiter) allow(user, channel, handler string) (bool, string, time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.take([]limitCheck{
+		{"user", user, r.user},
+		{"channel", channel, r.channel},
+		{"handler", handler + "#" + user, r.handlers[handler]},
+	})
+}
+
+// allowHears reports whether the user's message may be passed to the
+// named hears handler. Only the handler's own limit applies, so that
+// ordinary chatter does not use up the user's, or channel's, tokens.
+func (r *rateLimiter) allowHears(user, handler string) (bool, string, time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.take([]limitCheck{
+		{"handler", handler + "#" + user, r.handlers[handler]},
+	})
+}
+
+// take checks each of the limits, taking a token from each if all of
+// them permit the invocation. The lock must be held.
+func (r *rateLimiter) take(checks []limitCheck) (bool, string, time.Duration) {
+	now := r.now()
+	bs := make([]*bucket, len(checks))
+	for i, c := range checks {
+		if c.rl.unlimited() {
+			continue
+		}
+
+		k := c.scope + "#" + c.key
+		b, ok := r.buckets[k]
+		if !ok || b.rl != c.rl {
+			b = &bucket{rl: c.rl, tokens: float64(c.rl.Burst), last: now}
+			r.buckets[k] = b
+		}
+		b.fill(now)
+
+		if b.tokens < 1 {
+			wait := time.Duration((1 - b.tokens) * float64(c.rl.Every))
+			return false, c.scope, wait
+		}
+		bs[i] = b
+	}
+
+	for _, b := range bs {
+		if b != nil {
+			b.tokens--
+		}
+	}
+
+	if len(r.buckets) > maxBuckets {
+		r.prune(now)
+	}
+
+	return true, "", 0
+}
+
+// prune discards buckets that have refilled completely, and so are
+// indistinguishable from new ones.
+func (r *rateLimiter) prune(now time.Time) {
+	for k, b := range r.buckets {
+		if b.fill(now) {
+			delete(r.buckets, k)
+		}
+	}
+}
+
+// SetUserRateLimit limits how often any single user may invoke command
+// handlers on this mux. Hears handlers are only subject to their own
+// limits.
+func (mx *Mux) SetUserRateLimit(rl RateLimit) {
+	mx.limits.Lock()
+	defer mx.limits.Unlock()
+
+	mx.limits.user = rl
+}
+
+// SetChannelRateLimit limits how often command handlers may be invoked
+// within any single channel.
+func (mx *Mux) SetChannelRateLimit(rl RateLimit) {
+	mx.limits.Lock()
+	defer mx.limits.Unlock()
+
+	mx.limits.channel = rl
+}
+
+// SetHandlerRateLimit limits how often each user may invoke the named
+// handler. Messages that a hears handler is limited from hearing are
+// dropped without a reply.
+func (mx *Mux) SetHandlerRateLimit(name string, rl RateLimit) {
+	mx.limits.Lock()
+	defer mx.limits.Unlock()
+
+	mx.limits.handlers[name] = rl
+}
+
+// allow checks the rate limits for m invoking the command handler h, and
+// records any rejections.
+func (mx *Mux) allow(m *Message, h Handler) (bool, time.Duration) {
+	n, _ := h.Describe()
+	ok, scope, wait := mx.limits.allow(m.UserKey(), m.Channel, n)
+	if !ok {
+		rateLimitRejections.WithLabelValues(scope, n).Inc()
+	}
+	return ok, wait
+}
+
+// allowHears checks the rate limit of the hears handler h for m, and
+// records any rejections.
+func (mx *Mux) allowHears(m *Message, h Handler) bool {
+	n, _ := h.Describe()
+	ok, scope, _ := mx.limits.allowHears(m.UserKey(), n)
+	if !ok {
+		rateLimitRejections.WithLabelValues(scope, n).Inc()
+	}
+	return ok
+}
@@ -0,0 +1,101 @@
+package hugot
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	rl := newRateLimiter()
+	rl.now = func() time.Time { return now }
+	rl.user = RateLimit{Every: time.Minute, Burst: 2}
+	rl.handlers["deploy"] = RateLimit{Every: time.Hour, Burst: 1}
+
+	if ok, _, _ := rl.allow("bob", "ops", "deploy"); !ok {
+		t.Fatalf("first deploy should be allowed")
+	}
+
+	ok, scope, wait := rl.allow("bob", "ops", "deploy")
+	if ok || scope != "handler" || wait != time.Hour {
+		t.Fatalf("second deploy should be limited by handler, got %v %v %v", ok, scope, wait)
+	}
+
+	// The rejected deploy should not have used up a user token
+	if ok, _, _ := rl.allow("bob", "ops", "ping"); !ok {
+		t.Fatalf("ping should be allowed")
+	}
+
+	ok, scope, wait = rl.allow("bob", "ops", "ping")
+	if ok || scope != "user" || wait != time.Minute {
+		t.Fatalf("user should be limited, got %v %v %v", ok, scope, wait)
+	}
+
+	if ok, _, _ := rl.allow("alice", "ops", "ping"); !ok {
+		t.Fatalf("other users should not be limited")
+	}
+
+	now = now.Add(time.Minute)
+	if ok, _, _ := rl.allow("bob", "ops", "ping"); !ok {
+		t.Fatalf("bucket should have refilled")
+	}
+}
+
+func TestMux_RateLimitCommand(t *testing.T) {
+	mx := NewMux("test", "")
+	mx.HandleCommand(NewCommandHandler("deploy", "deploy things", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		fmt.Fprint(w, "deploying")
+		return nil
+	}, nil))
+	mx.SetHandlerRateLimit("deploy", RateLimit{Every: time.Hour, Burst: 1})
+
+	ts := &testSender{}
+	for _, txt := range []string{"deploy", "deploy", "help | deploy"} {
+		m := &Message{Channel: "ops", From: "bob", Text: txt, ToBot: true}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+	}
+
+	got := ts.texts()
+	if len(got) != 3 || got[0] != "deploying" || !strings.HasPrefix(got[1], "sorry bob") || !strings.HasPrefix(got[2], "sorry bob") {
+		t.Fatalf("expected later deploys to be throttled, got %#v", got)
+	}
+}
+
+func TestMux_RateLimitHears(t *testing.T) {
+	mx := NewMux("test", "")
+	mx.HandleCommand(NewCommandHandler("deploy", "deploy things", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		fmt.Fprint(w, "deploying")
+		return nil
+	}, nil))
+	heard := make(chan struct{}, 10)
+	mx.HandleHears(NewHearsHandler("chatter", "hears everything", regexp.MustCompile(`.`), func(ctx context.Context, w ResponseWriter, m *Message, sms [][]string) {
+		heard <- struct{}{}
+	}))
+	mx.SetUserRateLimit(RateLimit{Every: time.Hour, Burst: 1})
+	mx.SetHandlerRateLimit("chatter", RateLimit{Every: time.Hour, Burst: 2})
+
+	ts := &testSender{}
+	for i := 0; i < 3; i++ {
+		m := &Message{Channel: "ops", From: "bob", Text: "just chatting"}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+	}
+	for i := 0; i < 2; i++ {
+		<-heard
+	}
+
+	m := &Message{Channel: "ops", From: "bob", Text: "deploy", ToBot: true}
+	mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+
+	if got := ts.texts(); len(got) != 1 || got[0] != "deploying" {
+		t.Fatalf("chatter should not use up the user's tokens, got %#v", got)
+	}
+	select {
+	case <-heard:
+		t.Fatalf("chatter should be limited by its handler limit")
+	default:
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"errors"
+
+	"context"
+)
+
+// ErrNoReactions is returned when reacting to a message via an adapter
+// that does not support reactions.
+var ErrNoReactions = errors.New("adapter does not support reactions")
+
+// Reaction describes an emoji reaction being added to, or removed from,
+// a message. Adapters report reactions as a Message with the Reaction
+// set, the From, UserID and Channel of the message identify who reacted,
+// and where.
+type Reaction struct {
+	Emoji     string // The name of the emoji, without colons, e.g. "white_check_mark"
+	MessageID string // The ID of the message reacted to
+	Removed   bool   // True if the reaction was removed
+}
+
+// Reactor is implemented by adapters that can add emoji reactions to
+// messages. m identifies the message by its ID.
+type Reactor interface {
+	React(ctx context.Context, m *Message, emoji string) error
+	Unreact(ctx context.Context, m *Message, emoji string) error
+}
+
+// React adds the emoji reaction to the message m, via the adapter of the
+// response writer w.
+func React(ctx context.Context, w ResponseWriter, m *Message, emoji string) error {
+	if r, ok := w.(Reactor); ok {
+		return r.React(ctx, m, emoji)
+	}
+	return ErrNoReactions
+}
+
+// Unreact removes the bot's emoji reaction from the message m.
+func Unreact(ctx context.Context, w ResponseWriter, m *Message, emoji string) error {
+	if r, ok := w.(Reactor); ok {
+		return r.Unreact(ctx, m, emoji)
+	}
+	return ErrNoReactions
+}
+
+// React implements Reactor
+func (w *responseWriter) React(ctx context.Context, m *Message, emoji string) error {
+	r, ok := w.snd.(Reactor)
+	if !ok || m.ID == "" {
+		return ErrNoReactions
+	}
+	return r.React(ctx, w.outbound(m), emoji)
+}
+
+// Unreact implements Reactor
+func (w *responseWriter) Unreact(ctx context.Context, m *Message, emoji string) error {
+	r, ok := w.snd.(Reactor)
+	if !ok || m.ID == "" {
+		return ErrNoReactions
+	}
+	return r.Unreact(ctx, w.outbound(m), emoji)
+}
+
+// ReactionHandler is a handler that is called when reactions are added
+// to, or removed from, messages.
+type ReactionHandler interface {
+	Handler
+	Reacted(ctx context.Context, w ResponseWriter, m *Message)
+}
+
+// ReactionFunc describes the calling convention for Reaction handlers. The
+// reaction is available as m.Reaction.
+type ReactionFunc func(ctx context.Context, w ResponseWriter, m *Message)
+
+type baseReactionHandler struct {
+	Handler
+	emoji []string
+	rf    ReactionFunc
+}
+
+// NewReactionHandler wraps f as a Reaction handler. If any emoji are
+// given, f is only called for reactions using one of them.
+func NewReactionHandler(name, desc string, emoji []string, f ReactionFunc) ReactionHandler {
+	return &baseReactionHandler{
+		Handler: newBaseHandler(name, desc),
+		emoji:   emoji,
+		rf:      f,
+	}
+}
+
+func (brh *baseReactionHandler) Reacted(ctx context.Context, w ResponseWriter, m *Message) {
+	if len(brh.emoji) > 0 && !contains(brh.emoji, m.Reaction.Emoji) {
+		return
+	}
+	brh.rf(ctx, w, m)
+}
+
+// runReactionHandler passes the reaction m to the handler
+func runReactionHandler(ctx context.Context, h ReactionHandler, w ResponseWriter, m *Message) {
+	defer glogPanic()
+	h.Reacted(ctx, w, m)
+}
+
+// HandleReaction adds the provided handler to the DefaultMux
+func HandleReaction(h ReactionHandler) error {
+	return DefaultMux.HandleReaction(h)
+}
+
+// HandleReaction adds the provided handler to the mux. All reaction
+// handlers are called for every reaction.
+func (mx *Mux) HandleReaction(h ReactionHandler) error {
+	mx.Lock()
+	defer mx.Unlock()
+
+	mx.reactions = append(mx.reactions, h)
+	return nil
+}
+
+// react passes reactions to the reaction handlers
+func (mx *Mux) react(ctx context.Context, w ResponseWriter, m *Message) {
+	for _, h := range mx.reactions {
+		mc := *m
+		go runReactionHandler(ctx, h, w, &mc)
+	}
+}
@@ -0,0 +1,65 @@
+package hugot
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type testReactor struct {
+	testSender
+	reacted []string
+}
+
+func (ts *testReactor) React(ctx context.Context, m *Message, emoji string) error {
+	ts.Lock()
+	defer ts.Unlock()
+	ts.reacted = append(ts.reacted, fmt.Sprintf("+%s %s %s", emoji, m.Channel, m.ID))
+	return nil
+}
+
+func (ts *testReactor) Unreact(ctx context.Context, m *Message, emoji string) error {
+	ts.Lock()
+	defer ts.Unlock()
+	ts.reacted = append(ts.reacted, fmt.Sprintf("-%s %s %s", emoji, m.Channel, m.ID))
+	return nil
+}
+
+func TestMux_Reactions(t *testing.T) {
+	mx := NewMux("test", "")
+	done := make(chan struct{})
+	mx.HandleReaction(NewReactionHandler("ack", "", []string{"eyes"}, func(ctx context.Context, w ResponseWriter, m *Message) {
+		if !m.Reaction.Removed {
+			React(ctx, w, &Message{ID: m.Reaction.MessageID}, "ok")
+		} else {
+			Unreact(ctx, w, &Message{ID: m.Reaction.MessageID}, "ok")
+		}
+		done <- struct{}{}
+	}))
+
+	tr := &testReactor{}
+	for _, r := range []Reaction{
+		{Emoji: "thumbsup", MessageID: "1"},
+		{Emoji: "eyes", MessageID: "2"},
+		{Emoji: "eyes", MessageID: "2", Removed: true},
+	} {
+		r := r
+		m := &Message{Channel: "ops", From: "bob", Reaction: &r}
+		mx.ProcessMessage(context.Background(), newResponseWriter(tr, *m, "test"), m)
+		if r.Emoji == "eyes" {
+			<-done
+		}
+	}
+
+	if exp := []string{"+ok ops 2", "-ok ops 2"}; !reflect.DeepEqual(tr.reacted, exp) {
+		t.Errorf("expected %q, got %q", exp, tr.reacted)
+	}
+	if len(tr.msgs) != 0 {
+		t.Errorf("reactions should not be treated as messages, got %v", tr.texts())
+	}
+
+	if err := React(context.Background(), newResponseWriter(&testSender{}, Message{}, "test"), &Message{ID: "1"}, "ok"); err != ErrNoReactions {
+		t.Errorf("expected ErrNoReactions, got %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"context"
+)
+
+// RouteParams holds the values of the placeholders of a matched route.
+// They can be bound to a struct with Bind.
+type RouteParams map[string]string
+
+// RouteFunc describes the calling convention for route handlers
+type RouteFunc func(ctx context.Context, w ResponseWriter, m *Message, ps RouteParams) error
+
+type segKind int
+
+const (
+	segLiteral segKind = iota
+	segWord
+	segInt
+	segChoice
+	segText
+	segOptional
+)
+
+type routeSeg struct {
+	kind    segKind
+	text    string     // Literal text, or the name of a placeholder
+	choices []string   // Permitted values for a choice
+	opt     []routeSeg // Segments of an optional group
+}
+
+type route struct {
+	tmpl string
+	desc string
+	segs []routeSeg
+	f    RouteFunc
+}
+
+// parseRoute parses a route template. Templates are made up of literal
+// words, placeholders and optional groups, e.g.
+//
+//	deploy {app} to {env:prod|staging} [in {delay:int} minutes]
+//
+// Placeholders may have a type of word (the default), int, text, which
+// matches the remainder of the command, or a list of permitted values
+// separated by |.
+func parseRoute(tmpl string) ([]routeSeg, error) {
+	var stack [][]routeSeg
+	var segs []routeSeg
+	fs := strings.Fields(strings.NewReplacer("[", " [ ", "]", " ] ").Replace(tmpl))
+	for i, f := range fs {
+		switch {
+		case f == "[":
+			stack = append(stack, segs)
+			segs = nil
+		case f == "]":
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unbalanced ] in route %q", tmpl)
+			}
+			if len(segs) == 0 {
+				return nil, fmt.Errorf("empty optional group in route %q", tmpl)
+			}
+			opt := routeSeg{kind: segOptional, opt: segs}
+			segs = append(stack[len(stack)-1], opt)
+			stack = stack[:len(stack)-1]
+		case strings.HasPrefix(f, "{") && strings.HasSuffix(f, "}"):
+			s, err := parsePlaceholder(f[1 : len(f)-1])
+			if err != nil {
+				return nil, fmt.Errorf("route %q, %v", tmpl, err)
+			}
+			if s.kind == segText && (i != len(fs)-1 && !(i == len(fs)-2 && fs[i+1] == "]")) {
+				return nil, fmt.Errorf("route %q, text placeholder must be last", tmpl)
+			}
+			segs = append(segs, s)
+		default:
+			segs = append(segs, routeSeg{kind: segLiteral, text: f})
+		}
+	}
+
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("unbalanced [ in route %q", tmpl)
+	}
+	if len(segs) == 0 || segs[0].kind != segLiteral {
+		return nil, fmt.Errorf("route %q must start with a command name", tmpl)
+	}
+	return segs, nil
+}
+
+func parsePlaceholder(p string) (routeSeg, error) {
+	name, typ := p, "word"
+	if i := strings.Index(p, ":"); i != -1 {
+		name, typ = p[:i], p[i+1:]
+	}
+	if name == "" {
+		return routeSeg{}, fmt.Errorf("unnamed placeholder {%s}", p)
+	}
+
+	switch {
+	case typ == "word":
+		return routeSeg{kind: segWord, text: name}, nil
+	case typ == "int":
+		return routeSeg{kind: segInt, text: name}, nil
+	case typ == "text":
+		return routeSeg{kind: segText, text: name}, nil
+	case strings.Contains(typ, "|"):
+		return routeSeg{kind: segChoice, text: name, choices: strings.Split(typ, "|")}, nil
+	}
+	return routeSeg{}, fmt.Errorf("unknown placeholder type %q", typ)
+}
+
+// matchSegs matches args against segs, recording placeholder values in ps.
+func matchSegs(segs []routeSeg, args []string, ps RouteParams) bool {
+	if len(segs) == 0 {
+		return len(args) == 0
+	}
+
+	s, rest := segs[0], segs[1:]
+	if s.kind == segOptional {
+		try := append(append([]routeSeg{}, s.opt...), rest...)
+		if matchSegs(try, args, ps) {
+			return true
+		}
+		return matchSegs(rest, args, ps)
+	}
+
+	if len(args) == 0 {
+		return false
+	}
+
+	switch s.kind {
+	case segLiteral:
+		return strings.EqualFold(s.text, args[0]) && matchSegs(rest, args[1:], ps)
+	case segText:
+		ps[s.text] = strings.Join(args, " ")
+		return true
+	case segInt:
+		if _, err := strconv.Atoi(args[0]); err != nil {
+			return false
+		}
+	case segChoice:
+		if !contains(s.choices, args[0]) {
+			return false
+		}
+	}
+
+	ps[s.text] = args[0]
+	if matchSegs(rest, args[1:], ps) {
+		return true
+	}
+	delete(ps, s.text)
+	return false
+}
+
+// Router is a CommandHandler that runs the first of a set of routes whose
+// template matches the command line.
+type Router struct {
+	name string
+
+	sync.RWMutex
+	routes []route
+}
+
+// NewRouter creates an empty router for the command name
+func NewRouter(name string) *Router {
+	return &Router{name: name}
+}
+
+// Describe implements the Describer interface. The router is described
+// by its first route.
+func (r *Router) Describe() (string, string) {
+	r.RLock()
+	defer r.RUnlock()
+
+	if len(r.routes) == 0 {
+		return r.name, ""
+	}
+	return r.name, r.routes[0].desc
+}
+
+// HandleRoute adds a route to the router. The first word of the template
+// must be the router's name.
+func (r *Router) HandleRoute(tmpl, desc string, f RouteFunc) error {
+	segs, err := parseRoute(tmpl)
+	if err != nil {
+		return err
+	}
+	if segs[0].text != r.name {
+		return fmt.Errorf("route %q does not belong to command %s", tmpl, r.name)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.routes = append(r.routes, route{tmpl: tmpl, desc: desc, segs: segs, f: f})
+	return nil
+}
+
+// Routes returns the templates, and descriptions, of the router's routes.
+func (r *Router) Routes() ([]string, []string) {
+	r.RLock()
+	defer r.RUnlock()
+
+	var tmpls, descs []string
+	for _, rt := range r.routes {
+		tmpls = append(tmpls, rt.tmpl)
+		descs = append(descs, rt.desc)
+	}
+	return tmpls, descs
+}
+
+// Command implements the CommandHandler interface.
+func (r *Router) Command(ctx context.Context, w ResponseWriter, m *Message) error {
+	r.RLock()
+	routes := r.routes
+	r.RUnlock()
+
+	var args []string
+	if len(m.args) > 0 {
+		args = m.args[1:]
+	}
+
+	// Routes take no flags, a leading help flag shows the routes instead
+	// of being matched as an argument.
+	if len(args) > 0 {
+		switch args[0] {
+		case "-h", "-help", "--help":
+			return flag.ErrHelp
+		}
+	}
+
+	for _, rt := range routes {
+		ps := RouteParams{}
+		if matchSegs(rt.segs[1:], args, ps) {
+			return rt.f(ctx, w, m, ps)
+		}
+	}
+
+	tmpls, _ := r.Routes()
+	return fmt.Errorf("usage: %s", strings.Join(tmpls, ", "))
+}
+
+// HandleRoute adds a route to the DefaultMux
+func HandleRoute(tmpl, desc string, f RouteFunc) error {
+	return DefaultMux.HandleRoute(tmpl, desc, f)
+}
+
+// HandleRoute adds a command route to the mux. Routes are grouped into a
+// Router command by the first word of their template, which must not
+// already be used by another command.
+func (mx *Mux) HandleRoute(tmpl, desc string, f RouteFunc) error {
+	segs, err := parseRoute(tmpl)
+	if err != nil {
+		return err
+	}
+	name := segs[0].text
+
+	mx.Lock()
+	defer mx.Unlock()
+
+	var r *Router
+	switch h := (*mx.cmds)[name].(type) {
+	case nil:
+		r = NewRouter(name)
+		mx.cmds.AddCommandHandler(r)
+	case *Router:
+		r = h
+	default:
+		return fmt.Errorf("command %s is already handled by %T", name, h)
+	}
+
+	return r.HandleRoute(tmpl, desc, f)
+}
@@ -0,0 +1,80 @@
+package hugot
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMux_HandleRoute(t *testing.T) {
+	mx := NewMux("test", "")
+	route := func(tmpl string) {
+		err := mx.HandleRoute(tmpl, "test route", func(ctx context.Context, w ResponseWriter, m *Message, ps RouteParams) error {
+			fmt.Fprintf(w, "%s %v", tmpl, map[string]string(ps))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	route("deploy {app} to {env:prod|staging} [in {delay:int} minutes]")
+	route("deploy status [{app}]")
+	route("say {msg:text}")
+
+	tests := []struct {
+		txt string
+		exp string
+	}{
+		{"deploy web to prod", "deploy {app} to {env:prod|staging} [in {delay:int} minutes] map[app:web env:prod]"},
+		{"deploy web to staging in 5 minutes", "deploy {app} to {env:prod|staging} [in {delay:int} minutes] map[app:web delay:5 env:staging]"},
+		{"deploy status", "deploy status [{app}] map[]"},
+		{"deploy status db", "deploy status [{app}] map[app:db]"},
+		{"say hello   there", "say {msg:text} map[msg:hello there]"},
+		{"deploy web to dev", "error, usage: deploy {app} to {env:prod|staging} [in {delay:int} minutes], deploy status [{app}]"},
+		{"deploy web to prod in soon minutes", "error, usage: deploy {app} to {env:prod|staging} [in {delay:int} minutes], deploy status [{app}]"},
+	}
+
+	for _, tt := range tests {
+		ts := &testSender{}
+		m := &Message{Channel: "ops", From: "bob", Text: tt.txt, ToBot: true}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+		if got := ts.texts(); !reflect.DeepEqual(got, []string{tt.exp}) {
+			t.Errorf("%q: expected %q, got %q", tt.txt, tt.exp, got)
+		}
+	}
+
+	for _, bad := range []string{"{app} deploy", "say {msg:text} now", "deploy [{app}", "deploy {app:float}"} {
+		if err := mx.HandleRoute(bad, "", nil); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+	if err := mx.HandleRoute("help me", "", nil); err == nil {
+		t.Error("expected an error adding a route to an existing command")
+	}
+}
+
+func TestMux_HandleRouteHelp(t *testing.T) {
+	mx := NewMux("test", "")
+	ran := false
+	err := mx.HandleRoute("restart {app}", "restart an app", func(ctx context.Context, w ResponseWriter, m *Message, ps RouteParams) error {
+		ran = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, txt := range []string{"help restart", "restart -h", "restart -help"} {
+		ts := &testSender{}
+		m := &Message{Channel: "ops", From: "bob", Text: txt, ToBot: true}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+		if ran {
+			t.Fatalf("%q: ran a route", txt)
+		}
+		if got := strings.Join(ts.texts(), "\n"); !strings.Contains(got, "restart {app} - restart an app") {
+			t.Errorf("%q: expected usage, got %q", txt, got)
+		}
+	}
+}
@@ -25,8 +25,11 @@ func (p prefixStore) Unset(key []byte) error {
 }
 
 func newPrefixedStore(pfx []byte, s Storer) prefixStore {
+	// Cap the prefix so that appending keys always copies, rather than
+	// sharing a backing array between concurrent callers.
+	p := append(append([]byte{}, pfx...), []byte("#")...)
 	return prefixStore{
-		pfx:  append(pfx, []byte("#")...),
+		pfx:  p[:len(p):len(p)],
 		base: s,
 	}
 }
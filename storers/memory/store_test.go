@@ -1,14 +1,15 @@
-package memory
+package memory_test
 
 import (
 	"testing"
 
 	"github.com/tcolgate/hugot"
+	"github.com/tcolgate/hugot/storers/memory"
 )
 
 func TestStore(t *testing.T) {
 	var i interface{}
-	s := New()
+	s := memory.New()
 	i = s
 	_, ok := i.(hugot.Storer)
 
@@ -18,7 +19,7 @@ func TestStore(t *testing.T) {
 }
 
 func TestMemStore_Get(t *testing.T) {
-	s := New()
+	s := memory.New()
 	s.Set([]byte("test"), []byte("testval"))
 
 	v, ok, err := s.Get([]byte("test"))
@@ -28,7 +29,7 @@ func TestMemStore_Get(t *testing.T) {
 }
 
 func TestMemStore_Set(t *testing.T) {
-	s := New()
+	s := memory.New()
 	s.Set([]byte("test"), []byte("testval"))
 
 	v, ok, err := s.Get([]byte("test"))
@@ -45,7 +46,7 @@ func TestMemStore_Set(t *testing.T) {
 }
 
 func TestMemStore_Unet(t *testing.T) {
-	s := New()
+	s := memory.New()
 	s.Set([]byte("test"), []byte("testval"))
 
 	v, ok, err := s.Get([]byte("test"))
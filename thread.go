@@ -0,0 +1,69 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+// Thread returns the ID of the thread m belongs to. A message that is
+// not already in a thread starts a new thread.
+func (m *Message) Thread() string {
+	if m.ThreadID != "" {
+		return m.ThreadID
+	}
+	return m.ID
+}
+
+// ReplyInThread returns a reply to m, with Text txt, that will be sent
+// in m's thread.
+func (m *Message) ReplyInThread(txt string) *Message {
+	out := m.Reply(txt)
+	out.ID = ""
+	out.ThreadID = m.Thread()
+	return out
+}
+
+// SetThreadReplies sets whether the named handler on the DefaultMux
+// replies to messages in a thread.
+func SetThreadReplies(name string, on bool) {
+	DefaultMux.SetThreadReplies(name, on)
+}
+
+// SetThreadReplies sets whether the named command or hears handler
+// replies to messages in a thread by default. Replies to messages that
+// are already in a thread are always sent to that thread.
+func (mx *Mux) SetThreadReplies(name string, on bool) {
+	mx.Lock()
+	defer mx.Unlock()
+
+	mx.threads[name] = on
+}
+
+// threaded returns a writer that replies in the thread of m, if the
+// handler h replies in threads.
+func (mx *Mux) threaded(w ResponseWriter, m *Message, h Handler) ResponseWriter {
+	n, _ := h.Describe()
+	if !mx.threads[n] || m.Thread() == "" {
+		return w
+	}
+	return inThread(w, m.Thread())
+}
+
+// inThread returns a copy of w that sends messages to thread id.
+func inThread(w ResponseWriter, id string) ResponseWriter {
+	nw := w.Copy()
+	nw.SetThread(id)
+	return nw
+}
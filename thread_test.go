@@ -0,0 +1,92 @@
+package hugot
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestMux_ThreadReplies(t *testing.T) {
+	mx := NewMux("test", "")
+	mx.HandleCommand(NewCommandHandler("deploy", "", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		fmt.Fprint(w, "deploying")
+		return nil
+	}, nil))
+	heard := make(chan struct{})
+	mx.HandleHears(NewHearsHandler("lunch", "", regexp.MustCompile("lunch"), func(ctx context.Context, w ResponseWriter, m *Message, matches [][]string) {
+		fmt.Fprint(w, "pizza")
+		heard <- struct{}{}
+	}))
+
+	threads := func(m *Message) []string {
+		ts := &testSender{}
+		mx.ProcessMessage(context.Background(), newResponseWriter(ts, *m, "test"), m)
+		if !m.ToBot {
+			<-heard
+		}
+		var out []string
+		for _, m := range ts.msgs {
+			out = append(out, m.ThreadID)
+		}
+		return out
+	}
+
+	if got := threads(&Message{ID: "1", Text: "deploy", ToBot: true}); len(got) != 1 || got[0] != "" {
+		t.Errorf("expected reply in channel, got %q", got)
+	}
+	if got := threads(&Message{ID: "2", ThreadID: "1", Text: "deploy", ToBot: true}); len(got) != 1 || got[0] != "1" {
+		t.Errorf("expected reply in existing thread, got %q", got)
+	}
+
+	mx.SetThreadReplies("deploy", true)
+	mx.SetThreadReplies("lunch", true)
+	if got := threads(&Message{ID: "3", Text: "deploy", ToBot: true}); len(got) != 1 || got[0] != "3" {
+		t.Errorf("expected reply in new thread, got %q", got)
+	}
+	if got := threads(&Message{ID: "4", Text: "lunch?"}); len(got) != 1 || got[0] != "4" {
+		t.Errorf("expected hears reply in new thread, got %q", got)
+	}
+
+	if r := (&Message{ID: "5", From: "bob"}).ReplyInThread("ok"); r.ThreadID != "5" || r.ID != "" || r.To != "bob" {
+		t.Errorf("unexpected reply %#v", r)
+	}
+}
+
+func TestMux_ThreadPaged(t *testing.T) {
+	mx := NewMux("test", "")
+	mx.HandleCommand(NewCommandHandler("lines", "print some lines", func(ctx context.Context, w ResponseWriter, m *Message) error {
+		fmt.Fprint(w, "1\n2\n3")
+		return nil
+	}, nil))
+	mx.SetThreadReplies("lines", true)
+
+	ta := &testLimitedAdapter{}
+	ctx := NewAdapterContext(context.Background(), ta)
+	for _, m := range []*Message{{ID: "1", Channel: "ops", Text: "lines", ToBot: true}, {ID: "2", Channel: "ops", Text: "more"}} {
+		mx.ProcessMessage(ctx, newResponseWriter(ta, *m, "test"), m)
+	}
+
+	if len(ta.msgs) != 2 {
+		t.Fatalf("expected 2 pages, got %q", ta.texts())
+	}
+	for _, m := range ta.msgs {
+		if m.ThreadID != "1" || m.Channel != "ops" {
+			t.Errorf("expected page in thread 1 of ops, got %q in %q", m.ThreadID, m.Channel)
+		}
+	}
+}
+
+func TestResponseWriter_Copy(t *testing.T) {
+	ts := &testSender{}
+	in := Message{ID: "1", ThreadID: "0", Channel: "ops", From: "bob", To: "alice", Text: "hi", Private: true,
+		Event: &Event{Type: EventTopic}, Reaction: &Reaction{Emoji: "+1"}, Mentions: []Mention{{}}}
+	w := newResponseWriter(ts, in, "test").Copy()
+	fmt.Fprint(w, "ok")
+
+	exp := Message{Channel: "ops", To: "alice", ThreadID: "0", Text: "ok"}
+	if !reflect.DeepEqual(ts.msgs, []Message{exp}) {
+		t.Fatalf("expected %#v, got %#v", exp, ts.msgs)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2016 Tristan Colgate-McFarlane
+//
+// This file is part of hugot.
+//
+// hugot is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// hugot is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with hugot.  If not, see <http://www.gnu.org/licenses/>.
+
+package hugot
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Trigger describes how a message in a public channel is determined to
+// have been sent to the bot. Private messages are always sent to the bot.
+type Trigger struct {
+	Prefixes []string // Leading strings, such as "!", that address the bot
+	Mentions bool     // A leading mention of the bot's name addresses the bot
+	Anywhere bool     // A mention of the bot's name anywhere addresses the bot
+}
+
+// BotNamer is implemented by adapters that can report the forms by which
+// users may mention the bot, e.g. "minion", "@minion" or "<@U1234>".
+type BotNamer interface {
+	BotNames() []string
+}
+
+// TriggerSetter is implemented by adapters that permit configuring how
+// they decide a message was sent to the bot.
+type TriggerSetter interface {
+	SetTrigger(t Trigger)
+}
+
+// DefaultTrigger addresses the bot by a leading mention of its name
+var DefaultTrigger = Trigger{Mentions: true}
+
+// Match checks if txt was addressed to a bot known by any of names. If
+// it was, the addressing is stripped from the returned text.
+func (t Trigger) Match(names []string, txt string) (string, bool) {
+	for _, p := range t.Prefixes {
+		if p != "" && strings.HasPrefix(txt, p) {
+			return strings.TrimSpace(txt[len(p):]), true
+		}
+	}
+
+	if t.Mentions || t.Anywhere {
+		for _, n := range names {
+			if end, ok := foldPrefix(txt, n); ok && isMentionEnd(txt[end:]) {
+				return strings.TrimLeft(txt[end:], ":, \t"), true
+			}
+		}
+	}
+
+	if t.Anywhere {
+		for _, n := range names {
+			if txt, ok := stripMention(n, txt); ok {
+				return txt, true
+			}
+		}
+	}
+
+	return txt, false
+}
+
+// foldPrefix checks if s starts with n, ignoring case, and returns the
+// length in bytes of the matching prefix of s, which may differ from that
+// of n.
+func foldPrefix(s, n string) (int, bool) {
+	if n == "" {
+		return 0, false
+	}
+	end := 0
+	for range n {
+		if end == len(s) {
+			return 0, false
+		}
+		_, sz := utf8.DecodeRuneInString(s[end:])
+		end += sz
+	}
+	return end, strings.EqualFold(s[:end], n)
+}
+
+// isMentionEnd checks that rest follows a complete mention, rather than
+// the mention being a prefix of a longer word.
+func isMentionEnd(rest string) bool {
+	if rest == "" {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return r == ':' || r == ',' || unicode.IsSpace(r)
+}
+
+// stripMention removes the first whole word mention of n from txt.
+func stripMention(n, txt string) (string, bool) {
+	for i, r := range txt {
+		if i > 0 {
+			if pr, _ := utf8.DecodeLastRuneInString(txt[:i]); !unicode.IsSpace(pr) {
+				continue
+			}
+		}
+		if unicode.IsSpace(r) {
+			continue
+		}
+		l, ok := foldPrefix(txt[i:], n)
+		if !ok {
+			continue
+		}
+		end := i + l
+		if ar, _ := utf8.DecodeRuneInString(txt[end:]); end == len(txt) || strings.ContainsRune(":,.?! \t\n", ar) {
+			out := strings.TrimSpace(txt[:i]) + " " + strings.TrimLeft(txt[end:], ":, \t")
+			return strings.TrimSpace(out), true
+		}
+	}
+	return txt, false
+}
+
+// botNames returns the names an adapter's bot is known by.
+func botNames(s Sender) []string {
+	if bn, ok := s.(BotNamer); ok {
+		return bn.BotNames()
+	}
+	return nil
+}
+
+// SetTrigger sets the Trigger used by the DefaultMux
+func SetTrigger(t Trigger) {
+	DefaultMux.SetTrigger(t)
+}
+
+// SetTrigger overrides the adapters' own decision about whether a message
+// was sent to the bot, for all channels. This requires the adapter to
+// provide the RawText of messages, and to implement BotNamer.
+func (mx *Mux) SetTrigger(t Trigger) {
+	mx.Lock()
+	defer mx.Unlock()
+
+	mx.trigger = &t
+}
+
+// SetChannelTrigger sets the Trigger used for messages in the given channel,
+// overriding any set via SetTrigger.
+func (mx *Mux) SetChannelTrigger(channel string, t Trigger) {
+	mx.Lock()
+	defer mx.Unlock()
+
+	mx.chanTriggers[channel] = t
+}
+
+// applyTrigger re-evaluates whether m was sent to the bot, if the mux has
+// been configured with a trigger for m's channel.
+func (mx *Mux) applyTrigger(s Sender, m *Message) {
+	if m.Private || m.RawText == "" {
+		return
+	}
+
+	t, ok := mx.chanTriggers[m.Channel]
+	if !ok {
+		if mx.trigger == nil {
+			return
+		}
+		t = *mx.trigger
+	}
+
+	m.Text, m.ToBot = t.Match(botNames(s), m.RawText)
+}
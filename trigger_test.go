@@ -0,0 +1,36 @@
+package hugot
+
+import "testing"
+
+func TestTrigger_Match(t *testing.T) {
+	names := []string{"<@U1>", "@minion", "minion"}
+	tests := []struct {
+		t     Trigger
+		txt   string
+		exp   string
+		tobot bool
+	}{
+		{DefaultTrigger, "minion: ping", "ping", true},
+		{DefaultTrigger, "Minion, ping", "ping", true},
+		{DefaultTrigger, "<@U1> ping", "ping", true},
+		{DefaultTrigger, "minions are great", "minions are great", false},
+		{DefaultTrigger, "!ping", "!ping", false},
+		{DefaultTrigger, "hey minion ping", "hey minion ping", false},
+		{Trigger{Prefixes: []string{"!", "."}}, "!ping", "ping", true},
+		{Trigger{Prefixes: []string{"!", "."}}, ". ping", "ping", true},
+		{Trigger{Prefixes: []string{"!", "."}}, "minion: ping", "minion: ping", false},
+		{Trigger{Anywhere: true}, "hey minion, ping", "hey ping", true},
+		{Trigger{Anywhere: true}, "ping @minion", "ping", true},
+		{Trigger{Anywhere: true}, "the minions are great", "the minions are great", false},
+		{Trigger{Anywhere: true}, "ȺȺȺȺȺȺ xminion", "ȺȺȺȺȺȺ xminion", false},
+		{Trigger{Anywhere: true}, "İİİİİİ minion", "İİİİİİ", true},
+		{DefaultTrigger, "ⱥminion ping", "ⱥminion ping", false},
+	}
+
+	for _, tt := range tests {
+		txt, tobot := tt.t.Match(names, tt.txt)
+		if txt != tt.exp || tobot != tt.tobot {
+			t.Errorf("%#v %q: expected %q %v, got %q %v", tt.t, tt.txt, tt.exp, tt.tobot, txt, tobot)
+		}
+	}
+}